@@ -98,7 +98,7 @@ func (c *CPU) initInstructions() {
 			Name: fmt.Sprintf("LD (r16 %d), A", regID),
 			Method: func(c *CPU) {
 				addr := c.GetReg16(regID)
-				c.bus.Write(addr, c.A)
+				c.write(addr, c.A)
 			},
 			Cycles: 8,
 		}
@@ -108,7 +108,7 @@ func (c *CPU) initInstructions() {
 			Name: fmt.Sprintf("LD A, (r16 %d)", regID),
 			Method: func(c *CPU) {
 				addr := c.GetReg16(regID)
-				c.A = c.bus.Read(addr)
+				c.A = c.read(addr)
 			},
 			Cycles: 8,
 		}
@@ -138,7 +138,6 @@ func (c *CPU) initInstructions() {
 				if shouldCall {
 					c.push(c.PC)
 					c.PC = target
-					c.duration += 12
 				}
 			},
 			Cycles: 12,
@@ -168,7 +167,7 @@ func (c *CPU) initInstructions() {
 
 				if shouldJump {
 					c.PC = target
-					c.duration += 4
+					c.idle()
 				}
 			},
 			Cycles: 12,
@@ -194,9 +193,10 @@ func (c *CPU) initInstructions() {
 					shouldRet = (c.F & 0x10) != 0
 				}
 
+				c.idle()
 				if shouldRet {
 					c.PC = c.pop()
-					c.duration += 12
+					c.idle()
 				}
 			},
 			Cycles: 8,
@@ -222,6 +222,7 @@ func (c *CPU) initInstructions() {
 
 				c.SetReg16(2, uint16(sum))
 				c.setFlags(currentZ, false, halfCarry, carry)
+				c.idle()
 			},
 			Cycles: 8,
 		}
@@ -364,6 +365,7 @@ func (c *CPU) initInstructions() {
 			Method: func(c *CPU) {
 				val := c.GetReg16(regID)
 				c.SetReg16(regID, val+1)
+				c.idle()
 			},
 			Cycles: 8,
 		}
@@ -374,6 +376,7 @@ func (c *CPU) initInstructions() {
 			Method: func(c *CPU) {
 				val := c.GetReg16(regID)
 				c.SetReg16(regID, val-1)
+				c.idle()
 			},
 			Cycles: 8,
 		}
@@ -399,7 +402,7 @@ func (c *CPU) initInstructions() {
 		Name: "LD (nn), A",
 		Method: func(cpu *CPU) {
 			addr := cpu.fetchWord()
-			cpu.bus.Write(addr, cpu.A)
+			cpu.write(addr, cpu.A)
 		},
 		Cycles: 16,
 	}
@@ -408,7 +411,7 @@ func (c *CPU) initInstructions() {
 		Name: "LD A, (nn)",
 		Method: func(cpu *CPU) {
 			addr := cpu.fetchWord()
-			cpu.A = cpu.bus.Read(addr)
+			cpu.A = cpu.read(addr)
 		},
 		Cycles: 16,
 	}
@@ -416,7 +419,7 @@ func (c *CPU) initInstructions() {
 		Name: "LDH n, A",
 		Method: func(cpu *CPU) {
 			addr := cpu.fetchByte()
-			cpu.bus.Write(0xFF00+uint16(addr), c.A)
+			cpu.write(0xFF00+uint16(addr), c.A)
 		},
 		Cycles: 12,
 	}
@@ -424,14 +427,29 @@ func (c *CPU) initInstructions() {
 		Name: "LDH A, n",
 		Method: func(cpu *CPU) {
 			addr := cpu.fetchByte()
-			val := cpu.bus.Read(0xFF00 + uint16(addr))
+			val := cpu.read(0xFF00 + uint16(addr))
 			c.A = val
 		},
 		Cycles: 12,
 	}
+	c.instructions[0xE2] = Instruction{
+		Name: "LD (C), A",
+		Method: func(c *CPU) {
+			c.write(0xFF00+uint16(c.C), c.A)
+		},
+		Cycles: 8,
+	}
+	c.instructions[0xF2] = Instruction{
+		Name: "LD A, (C)",
+		Method: func(c *CPU) {
+			c.A = c.read(0xFF00 + uint16(c.C))
+		},
+		Cycles: 8,
+	}
 	c.instructions[0xC3] = Instruction{
 		Name: "JP nn", Cycles: 16, Method: func(c *CPU) {
 			c.PC = c.fetchWord()
+			c.idle()
 		},
 	}
 
@@ -441,6 +459,7 @@ func (c *CPU) initInstructions() {
 		Method: func(c *CPU) {
 			offset := int8(c.fetchByte())
 			c.PC = uint16(int32(c.PC) + int32(offset))
+			c.idle()
 		},
 	}
 
@@ -455,15 +474,14 @@ func (c *CPU) initInstructions() {
 	c.instructions[0xC9] = Instruction{
 		Name: "RET", Cycles: 16, Method: func(c *CPU) {
 			c.PC = c.pop()
+			c.idle()
 		},
 	}
 
 	c.instructions[0xCB] = Instruction{
 		Name: "PREFIX CB", Cycles: 0, Method: func(c *CPU) {
 			cbOpcode := c.fetchByte()
-			ins := c.cbInstructions[cbOpcode]
-			ins.Method(c)
-			c.duration += ins.Cycles
+			c.cbInstructions[cbOpcode].Method(c)
 		},
 	}
 
@@ -484,7 +502,7 @@ func (c *CPU) initInstructions() {
 		Name: "LDI (HL), A",
 		Method: func(c *CPU) {
 			addr := c.GetReg16(2)
-			c.bus.Write(addr, c.A)
+			c.write(addr, c.A)
 			c.SetReg16(2, addr+1)
 		},
 		Cycles: 8,
@@ -494,7 +512,7 @@ func (c *CPU) initInstructions() {
 		Name: "LDI A, (HL)",
 		Method: func(c *CPU) {
 			addr := c.GetReg16(2)
-			c.A = c.bus.Read(addr)
+			c.A = c.read(addr)
 			c.SetReg16(2, addr+1)
 		},
 		Cycles: 8,
@@ -504,7 +522,7 @@ func (c *CPU) initInstructions() {
 		Name: "LDD (HL), A",
 		Method: func(c *CPU) {
 			addr := c.GetReg16(2)
-			c.bus.Write(addr, c.A)
+			c.write(addr, c.A)
 			c.SetReg16(2, addr-1)
 		},
 		Cycles: 8,
@@ -514,7 +532,7 @@ func (c *CPU) initInstructions() {
 		Name: "LDD A, (HL)",
 		Method: func(c *CPU) {
 			addr := c.GetReg16(2)
-			c.A = c.bus.Read(addr)
+			c.A = c.read(addr)
 			c.SetReg16(2, addr-1)
 		},
 		Cycles: 8,
@@ -526,7 +544,7 @@ func (c *CPU) initInstructions() {
 			offset := int8(c.fetchByte())
 			if (c.F & 0x80) == 0 {
 				c.PC = uint16(int32(c.PC) + int32(offset))
-				c.duration += 4
+				c.idle()
 			}
 		},
 		Cycles: 8,
@@ -538,7 +556,7 @@ func (c *CPU) initInstructions() {
 			offset := int8(c.fetchByte())
 			if (c.F & 0x80) != 0 {
 				c.PC = uint16(int32(c.PC) + int32(offset))
-				c.duration += 4
+				c.idle()
 			}
 		},
 		Cycles: 8,
@@ -550,7 +568,7 @@ func (c *CPU) initInstructions() {
 			offset := int8(c.fetchByte())
 			if (c.F & 0x10) == 0 {
 				c.PC = uint16(int32(c.PC) + int32(offset))
-				c.duration += 4
+				c.idle()
 			}
 		},
 		Cycles: 8,
@@ -562,7 +580,7 @@ func (c *CPU) initInstructions() {
 			offset := int8(c.fetchByte())
 			if (c.F & 0x10) != 0 {
 				c.PC = uint16(int32(c.PC) + int32(offset))
-				c.duration += 4
+				c.idle()
 			}
 		},
 		Cycles: 8,
@@ -580,6 +598,7 @@ func (c *CPU) initInstructions() {
 		Name: "LD SP, HL",
 		Method: func(c *CPU) {
 			c.SP = c.GetReg16(2)
+			c.idle()
 		},
 		Cycles: 8,
 	}
@@ -648,6 +667,7 @@ func (c *CPU) initInstructions() {
 			val := uint16(int32(c.SP) + int32(signedByte))
 
 			c.SetReg16(2, val)
+			c.idle()
 
 			rawOffset := uint16(uint8(signedByte))
 
@@ -778,7 +798,10 @@ func (c *CPU) initInstructions() {
 		c.instructions[0x10] = Instruction{
 			Name: "STOP",
 			Method: func(c *CPU) {
-				c.fetchByte()
+				c.PC++
+				if s, ok := c.bus.(speedSwitcher); ok {
+					s.SwitchSpeed()
+				}
 			},
 			Cycles: 4,
 		}
@@ -796,8 +819,8 @@ func (c *CPU) initInstructions() {
 				addr := c.fetchWord()
 				low := uint8(c.SP & 0xFF)
 				high := uint8(c.SP >> 8)
-				c.bus.Write(addr, low)
-				c.bus.Write(addr+1, high)
+				c.write(addr, low)
+				c.write(addr+1, high)
 			},
 			Cycles: 20,
 		}
@@ -813,6 +836,8 @@ func (c *CPU) initInstructions() {
 
 				c.SP = uint16(int32(c.SP) + int32(signedByte))
 				c.setFlags(false, false, halfCarry, carry)
+				c.idle()
+				c.idle()
 			},
 			Cycles: 16,
 		}
@@ -0,0 +1,51 @@
+package main
+
+import "testing"
+
+func TestInstructionCycles(t *testing.T) {
+	m := NewMMU(ModelDMG)
+	c := NewCPU(m)
+	step := func(f uint8, code ...uint8) int {
+		c.PC, c.SP, c.F = 0xC000, 0xD000, f
+		c.B, c.C, c.D, c.E, c.H, c.L = 0xC2, 0x00, 0xC3, 0x00, 0xC1, 0x00
+		for i, b := range append(code, 0, 0) {
+			m.Write(0xC000+uint16(i), b)
+		}
+		return c.Step()
+	}
+	branchExtra := map[uint8]int{0x20: 4, 0xC0: 12, 0xC2: 4, 0xC4: 12}
+
+	for op := range 256 {
+		opcode, ins := uint8(op), c.instructions[op]
+		if ins.Name == "UNKNOWN" || opcode == 0xCB {
+			continue
+		}
+		extra, conditional := branchExtra[opcode&^0x18]
+		if !conditional {
+			if got := step(0, opcode); got != ins.Cycles {
+				t.Errorf("%02X %s: %d cycles, want %d", opcode, ins.Name, got, ins.Cycles)
+			}
+			continue
+		}
+		flag := uint8(0x80)
+		if opcode&0x10 != 0 {
+			flag = 0x10
+		}
+		for _, f := range []uint8{0x00, 0x90} {
+			want := ins.Cycles
+			if f&flag != 0 == (opcode&0x08 != 0) {
+				want += extra
+			}
+			if got := step(f, opcode); got != want {
+				t.Errorf("%02X %s with F=%02X: %d cycles, want %d", opcode, ins.Name, f, got, want)
+			}
+		}
+	}
+
+	for op := range 256 {
+		ins := c.cbInstructions[op]
+		if got := step(0, 0xCB, uint8(op)); got != ins.Cycles {
+			t.Errorf("CB %02X %s: %d cycles, want %d", op, ins.Name, got, ins.Cycles)
+		}
+	}
+}
@@ -5,15 +5,50 @@ type Memory interface {
 	Write(addr uint16, val uint8)
 }
 
+type busTicker interface {
+	Tick(cycles int)
+}
+
+type speedSwitcher interface {
+	SwitchSpeed() bool
+}
+
 type MMU struct {
 	rom  [0x8000]byte
-	vram [0x2000]byte
+	vram [2][0x2000]byte
 	eram [0x2000]byte
-	wram [0x2000]byte
+	wram [8][0x1000]byte
 	oam  [0xA0]byte
 	io   [0x80]byte
 	hram [0x7F]byte
 	ie   byte
+
+	joypad    Joypad
+	serial    Serial
+	apu       *APU
+	apuSynced uint64
+	div       uint16
+	sched     *Scheduler
+
+	model       Model
+	cgb         bool
+	vbk         uint8
+	svbk        uint8
+	prepare     bool
+	doubleSpeed bool
+	bgPalette   cgbPalette
+	objPalette  cgbPalette
+	hdma        hdma
+	stall       int
+	sgb         *SGB
+}
+
+func NewMMU(model Model) *MMU {
+	m := &MMU{apu: NewAPU(), model: model, sched: newScheduler(), hdma: hdma{status: 0xFF}}
+	m.apu.SetModel(model)
+	m.sched.Schedule(eventFrameSequencer, frameSequencerPeriod, m.clockFrameSequencer)
+	m.sched.Schedule(eventSerialPeer, serialPeerQuantum, m.tickSerialPeer)
+	return m
 }
 
 func (m *MMU) Read(a uint16) uint8 {
@@ -24,15 +59,19 @@ func (m *MMU) Read(a uint16) uint8 {
 
 	case a >= 0x8000 && a < 0xA000:
 
-		return m.vram[a-0x8000]
+		return m.vram[m.vbk][a-0x8000]
 
 	case a >= 0xA000 && a < 0xC000:
 
 		return m.eram[a-0xA000]
 
-	case a >= 0xC000 && a < 0xE000:
+	case a >= 0xC000 && a < 0xD000:
+
+		return m.wram[0][a-0xC000]
+
+	case a >= 0xD000 && a < 0xE000:
 
-		return m.wram[a-0xC000]
+		return m.wram[m.wramBank()][a-0xD000]
 
 	case a >= 0xE000 && a < 0xFE00:
 
@@ -42,6 +81,27 @@ func (m *MMU) Read(a uint16) uint8 {
 
 		return m.oam[a-0xFE00]
 
+	case a == 0xFF00:
+
+		return m.readP1()
+
+	case a == 0xFF01 || a == 0xFF02:
+
+		return m.serial.Read(a)
+
+	case a == 0xFF04:
+
+		return uint8(m.div >> 8)
+
+	case a >= 0xFF10 && a < 0xFF40:
+
+		m.Sync()
+		return m.apu.Read(a)
+
+	case isCGBRegister(a):
+
+		return m.readCGB(a)
+
 	case a >= 0xFF00 && a < 0xFF80:
 
 		return m.io[a-0xFF00]
@@ -67,17 +127,40 @@ func (m *MMU) Write(a uint16, v uint8) {
 		return
 
 	case a >= 0x8000 && a < 0xA000:
-		m.vram[a-0x8000] = v
+		m.vram[m.vbk][a-0x8000] = v
 
 	case a >= 0xA000 && a < 0xC000:
 		m.eram[a-0xA000] = v
 
-	case a >= 0xC000 && a < 0xE000:
-		m.wram[a-0xC000] = v
+	case a >= 0xC000 && a < 0xD000:
+		m.wram[0][a-0xC000] = v
+
+	case a >= 0xD000 && a < 0xE000:
+		m.wram[m.wramBank()][a-0xD000] = v
 
 	case a >= 0xFE00 && a < 0xFEA0:
 		m.oam[a-0xFE00] = v
 
+	case a == 0xFF00:
+		m.writeP1(v)
+
+	case a == 0xFF01:
+		m.serial.Write(a, v)
+
+	case a == 0xFF02:
+		m.serial.Write(a, v)
+		m.scheduleSerial()
+
+	case a == 0xFF04:
+		m.resetDIV()
+
+	case a >= 0xFF10 && a < 0xFF40:
+		m.Sync()
+		m.apu.Write(a, v)
+
+	case isCGBRegister(a):
+		m.writeCGB(a, v)
+
 	case a >= 0xFF00 && a < 0xFF80:
 		m.io[a-0xFF00] = v
 
@@ -91,4 +174,118 @@ func (m *MMU) Write(a uint16, v uint8) {
 
 func (m *MMU) LoadCartridge(rom []byte) {
 	copy(m.rom[:], rom)
+	m.cgb = m.model == ModelCGB && m.rom[0x143]&0x80 != 0
+	m.serial.cgb = m.cgb
+	if m.model == ModelSGB && sgbSupported(m.rom[:]) {
+		m.sgb = newSGB(m)
+	}
+}
+
+func (m *MMU) CGB() bool {
+	return m.cgb
+}
+
+func (m *MMU) DoubleSpeed() bool {
+	return m.doubleSpeed
+}
+
+func (m *MMU) SwitchSpeed() bool {
+	if !m.cgb || !m.prepare {
+		return false
+	}
+	m.prepare = false
+	m.doubleSpeed = !m.doubleSpeed
+	m.resetDIV()
+	return true
+}
+
+func (m *MMU) BGColor(palette, index int) uint16 {
+	return m.bgPalette.Color(palette, index)
+}
+
+func (m *MMU) OBJColor(palette, index int) uint16 {
+	return m.objPalette.Color(palette, index)
+}
+
+func (m *MMU) wramBank() uint8 {
+	return max(m.svbk, 1)
+}
+
+func (m *MMU) divShift() uint32 {
+	if m.doubleSpeed {
+		return 14
+	}
+	return 13
+}
+
+func (m *MMU) resetDIV() {
+	if uint32(m.div)&(1<<(m.divShift()-1)) != 0 {
+		m.Sync()
+		m.apu.ClockFrameSequencer()
+	}
+	m.div = 0
+	m.sched.Schedule(eventFrameSequencer, frameSequencerPeriod, m.clockFrameSequencer)
+}
+
+func (m *MMU) clockFrameSequencer() {
+	m.Sync()
+	m.apu.ClockFrameSequencer()
+	m.sched.Schedule(eventFrameSequencer, frameSequencerPeriod, m.clockFrameSequencer)
+}
+
+func (m *MMU) scheduleSerial() {
+	n := m.serial.transferCycles()
+	if n == 0 {
+		m.sched.Cancel(eventSerial)
+		return
+	}
+	m.sched.Schedule(eventSerial, m.baseCycles(n), m.serial.complete)
+}
+
+func (m *MMU) tickSerialPeer() {
+	n := serialPeerQuantum
+	if m.doubleSpeed {
+		n *= 2
+	}
+	m.serial.Tick(n)
+	m.sched.Schedule(eventSerialPeer, serialPeerQuantum, m.tickSerialPeer)
+}
+
+func (m *MMU) baseCycles(cycles int) int {
+	if m.doubleSpeed {
+		return cycles / 2
+	}
+	return cycles
+}
+
+func (m *MMU) Sync() {
+	if now := m.sched.Now(); now > m.apuSynced {
+		m.apu.Tick(int(now - m.apuSynced))
+		m.apuSynced = now
+	}
+}
+
+func (m *MMU) Scheduler() *Scheduler {
+	return m.sched
+}
+
+func (m *MMU) Serial() *Serial {
+	return &m.serial
+}
+
+func (m *MMU) APU() *APU {
+	return m.apu
+}
+
+func (m *MMU) Tick(cycles int) {
+	m.div += uint16(cycles)
+	m.sched.Advance(m.baseCycles(cycles))
+
+	if m.serial.takeIRQ() {
+		m.io[0x0F] |= 0x08
+	}
+	if m.joypad.irq {
+		m.joypad.irq = false
+		m.io[0x0F] |= 0x10
+	}
 }
@@ -0,0 +1,689 @@
+package main
+
+const cpuClock = 4194304
+
+var dutyPatterns = [4][8]uint8{
+	{0, 0, 0, 0, 0, 0, 0, 1},
+	{1, 0, 0, 0, 0, 0, 0, 1},
+	{1, 0, 0, 0, 0, 1, 1, 1},
+	{0, 1, 1, 1, 1, 1, 1, 0},
+}
+
+var noiseDivisors = [8]int{8, 16, 32, 48, 64, 80, 96, 112}
+
+var apuReadMasks = [0x17]uint8{
+	0x80, 0x3F, 0x00, 0xFF, 0xBF,
+	0xFF, 0x3F, 0x00, 0xFF, 0xBF,
+	0x7F, 0xFF, 0x9F, 0xFF, 0xBF,
+	0xFF, 0xFF, 0x00, 0x00, 0xBF,
+	0x00, 0x00, 0x70,
+}
+
+type lengthCounter struct {
+	max     int
+	value   int
+	enabled bool
+}
+
+func (l *lengthCounter) clock() bool {
+	if !l.enabled || l.value == 0 {
+		return false
+	}
+	l.value--
+	return l.value == 0
+}
+
+type envelope struct {
+	initial  uint8
+	increase bool
+	period   uint8
+	timer    uint8
+	volume   uint8
+}
+
+func (e *envelope) write(v uint8) {
+	e.initial = v >> 4
+	e.increase = v&0x08 != 0
+	e.period = v & 0x07
+}
+
+func (e *envelope) dacEnabled() bool {
+	return e.initial != 0 || e.increase
+}
+
+func (e *envelope) trigger() {
+	e.volume = e.initial
+	e.timer = e.period
+}
+
+func (e *envelope) clock() {
+	if e.period == 0 {
+		return
+	}
+	e.timer--
+	if e.timer > 0 {
+		return
+	}
+	e.timer = e.period
+	if e.increase && e.volume < 15 {
+		e.volume++
+	} else if !e.increase && e.volume > 0 {
+		e.volume--
+	}
+}
+
+type squareChannel struct {
+	enabled   bool
+	duty      uint8
+	dutyPos   uint8
+	frequency uint16
+	timer     int
+	length    lengthCounter
+	envelope  envelope
+
+	sweepPeriod  uint8
+	sweepNegate  bool
+	sweepShift   uint8
+	sweepTimer   uint8
+	sweepEnabled bool
+	sweepShadow  uint16
+	negateUsed   bool
+}
+
+func (s *squareChannel) reload() {
+	s.timer = (2048 - int(s.frequency)) * 4
+}
+
+func (s *squareChannel) step(cycles int) {
+	s.timer -= cycles
+	for s.timer <= 0 {
+		s.timer += (2048 - int(s.frequency)) * 4
+		s.dutyPos = (s.dutyPos + 1) & 0x07
+	}
+}
+
+func (s *squareChannel) output() uint8 {
+	if !s.enabled {
+		return 0
+	}
+	return dutyPatterns[s.duty][s.dutyPos] * s.envelope.volume
+}
+
+func (s *squareChannel) sweepCalculate() uint16 {
+	delta := s.sweepShadow >> s.sweepShift
+	var next uint16
+	if s.sweepNegate {
+		next = s.sweepShadow - delta
+		s.negateUsed = true
+	} else {
+		next = s.sweepShadow + delta
+	}
+	if next > 2047 {
+		s.enabled = false
+	}
+	return next
+}
+
+func (s *squareChannel) sweepReload() {
+	s.sweepTimer = s.sweepPeriod
+	if s.sweepTimer == 0 {
+		s.sweepTimer = 8
+	}
+}
+
+func (s *squareChannel) sweepTrigger() {
+	s.sweepShadow = s.frequency
+	s.sweepReload()
+	s.sweepEnabled = s.sweepPeriod != 0 || s.sweepShift != 0
+	s.negateUsed = false
+	if s.sweepShift != 0 {
+		s.sweepCalculate()
+	}
+}
+
+func (s *squareChannel) sweepClock() {
+	s.sweepTimer--
+	if s.sweepTimer > 0 {
+		return
+	}
+	s.sweepReload()
+	if !s.sweepEnabled || s.sweepPeriod == 0 {
+		return
+	}
+	next := s.sweepCalculate()
+	if next <= 2047 && s.sweepShift != 0 {
+		s.frequency = next
+		s.sweepShadow = next
+		s.sweepCalculate()
+	}
+}
+
+type waveChannel struct {
+	enabled    bool
+	dacEnabled bool
+	volume     uint8
+	frequency  uint16
+	timer      int
+	position   uint8
+	sample     uint8
+	length     lengthCounter
+	ram        [16]uint8
+}
+
+func (w *waveChannel) reload() {
+	w.timer = (2048 - int(w.frequency)) * 2
+}
+
+func (w *waveChannel) step(cycles int) {
+	w.timer -= cycles
+	for w.timer <= 0 {
+		w.timer += (2048 - int(w.frequency)) * 2
+		w.position = (w.position + 1) & 0x1F
+		w.sample = w.ram[w.position/2]
+		if w.position&1 == 0 {
+			w.sample >>= 4
+		}
+		w.sample &= 0x0F
+	}
+}
+
+func (w *waveChannel) output() uint8 {
+	if !w.enabled || w.volume == 0 {
+		return 0
+	}
+	return w.sample >> (w.volume - 1)
+}
+
+type noiseChannel struct {
+	enabled    bool
+	clockShift uint8
+	widthMode  bool
+	divisor    uint8
+	timer      int
+	lfsr       uint16
+	length     lengthCounter
+	envelope   envelope
+}
+
+func (n *noiseChannel) period() int {
+	return noiseDivisors[n.divisor] << n.clockShift
+}
+
+func (n *noiseChannel) step(cycles int) {
+	n.timer -= cycles
+	for n.timer <= 0 {
+		n.timer += n.period()
+		if n.clockShift >= 14 {
+			continue
+		}
+		xor := (n.lfsr & 1) ^ ((n.lfsr >> 1) & 1)
+		n.lfsr = (n.lfsr >> 1) | xor<<14
+		if n.widthMode {
+			n.lfsr = n.lfsr&^(1<<6) | xor<<6
+		}
+	}
+}
+
+func (n *noiseChannel) output() uint8 {
+	if !n.enabled || n.lfsr&1 != 0 {
+		return 0
+	}
+	return n.envelope.volume
+}
+
+type APU struct {
+	power     bool
+	nr50      uint8
+	nr51      uint8
+	regs      [0x17]uint8
+	frameStep uint8
+
+	ch1 squareChannel
+	ch2 squareChannel
+	ch3 waveChannel
+	ch4 noiseChannel
+
+	model      Model
+	sampleRate int
+	time       uint64
+	clock      uint64
+	output     *stereoStream
+	vgm        *VGMWriter
+
+	muted       [4]bool
+	solo        [4]bool
+	stems       [4]*stereoStream
+	stemSamples [4][]int16
+}
+
+func NewAPU() *APU {
+	a := &APU{}
+	a.resetChannels()
+	a.Write(0xFF26, 0x80)
+	a.Write(0xFF24, 0x77)
+	a.Write(0xFF25, 0xF3)
+	return a
+}
+
+func (a *APU) SetModel(model Model) {
+	a.model = model
+	a.SetSampleRate(a.sampleRate)
+}
+
+func (a *APU) SetSampleRate(rate int) {
+	a.sampleRate = rate
+	a.time = 0
+	a.output = nil
+	if rate != 0 {
+		a.output = newStereoStream(a.model, rate)
+	}
+	a.EnableStems(a.stems[0] != nil)
+}
+
+func (a *APU) SetChannelMuted(ch int, muted bool) {
+	a.muted[ch] = muted
+	a.updateOutput()
+}
+
+func (a *APU) SetChannelSolo(ch int, solo bool) {
+	a.solo[ch] = solo
+	a.updateOutput()
+}
+
+func (a *APU) channelAudible(ch int) bool {
+	if a.muted[ch] {
+		return false
+	}
+	soloed := a.solo[0] || a.solo[1] || a.solo[2] || a.solo[3]
+	return !soloed || a.solo[ch]
+}
+
+func (a *APU) EnableStems(enabled bool) {
+	for ch := range a.stems {
+		a.stems[ch] = nil
+		a.stemSamples[ch] = nil
+		if enabled && a.sampleRate != 0 {
+			a.stems[ch] = newStereoStream(a.model, a.sampleRate)
+		}
+	}
+}
+
+func (a *APU) Samples() []int16 {
+	if a.sampleRate == 0 {
+		return nil
+	}
+	samples := a.output.endFrame(a.time, nil)
+	for ch, stem := range a.stems {
+		if stem != nil {
+			a.stemSamples[ch] = stem.endFrame(a.time, a.stemSamples[ch])
+		}
+	}
+	a.time = 0
+	return samples
+}
+
+func (a *APU) Stems() [4][]int16 {
+	stems := a.stemSamples
+	a.stemSamples = [4][]int16{}
+	return stems
+}
+
+func (a *APU) Read(addr uint16) uint8 {
+	switch {
+	case addr >= 0xFF30 && addr < 0xFF40:
+		return a.ch3.ram[addr-0xFF30]
+	case addr == 0xFF26:
+		v := uint8(0x70)
+		if a.power {
+			v |= 0x80
+		}
+		if a.ch1.enabled {
+			v |= 0x01
+		}
+		if a.ch2.enabled {
+			v |= 0x02
+		}
+		if a.ch3.enabled {
+			v |= 0x04
+		}
+		if a.ch4.enabled {
+			v |= 0x08
+		}
+		return v
+	case addr >= 0xFF10 && addr < 0xFF26:
+		return a.regs[addr-0xFF10] | apuReadMasks[addr-0xFF10]
+	}
+	return 0xFF
+}
+
+func (a *APU) LogVGM(v *VGMWriter) {
+	a.vgm = v
+	if v == nil {
+		return
+	}
+	v.Log(a.clock, 0xFF26, a.Read(0xFF26)&0x80)
+	for addr := uint16(0xFF10); addr < 0xFF26; addr++ {
+		if !apuRegisterUsed(addr) {
+			continue
+		}
+		val := a.regs[addr-0xFF10]
+		switch addr {
+		case 0xFF14, 0xFF19, 0xFF1E, 0xFF23:
+			val &^= 0x80
+		}
+		v.Log(a.clock, addr, val)
+	}
+	for addr := uint16(0xFF30); addr < 0xFF40; addr++ {
+		v.Log(a.clock, addr, a.ch3.ram[addr-0xFF30])
+	}
+}
+
+func (a *APU) StopVGM() error {
+	if a.vgm == nil {
+		return nil
+	}
+	err := a.vgm.Close(a.clock)
+	a.vgm = nil
+	return err
+}
+
+func apuRegisterUsed(addr uint16) bool {
+	switch {
+	case addr == 0xFF15, addr == 0xFF1F:
+		return false
+	case addr >= 0xFF27 && addr < 0xFF30:
+		return false
+	}
+	return addr >= 0xFF10 && addr < 0xFF40
+}
+
+func (a *APU) Write(addr uint16, v uint8) {
+	if a.vgm != nil && apuRegisterUsed(addr) {
+		a.vgm.Log(a.clock, addr, v)
+	}
+	a.write(addr, v)
+	a.updateOutput()
+}
+
+func (a *APU) write(addr uint16, v uint8) {
+	if addr >= 0xFF30 && addr < 0xFF40 {
+		a.ch3.ram[addr-0xFF30] = v
+		return
+	}
+	if addr == 0xFF26 {
+		a.setPower(v&0x80 != 0)
+		return
+	}
+	if addr < 0xFF10 || addr >= 0xFF26 || !a.power {
+		return
+	}
+
+	a.regs[addr-0xFF10] = v
+	lengthClocking := a.frameStep&1 == 1
+
+	switch addr {
+	case 0xFF10:
+		a.ch1.sweepPeriod = (v >> 4) & 0x07
+		negate := v&0x08 != 0
+		if a.ch1.sweepNegate && !negate && a.ch1.negateUsed {
+			a.ch1.enabled = false
+		}
+		a.ch1.sweepNegate = negate
+		a.ch1.sweepShift = v & 0x07
+	case 0xFF11:
+		a.ch1.duty = v >> 6
+		a.ch1.length.value = 64 - int(v&0x3F)
+	case 0xFF12:
+		a.ch1.envelope.write(v)
+		if !a.ch1.envelope.dacEnabled() {
+			a.ch1.enabled = false
+		}
+	case 0xFF13:
+		a.ch1.frequency = a.ch1.frequency&0x700 | uint16(v)
+	case 0xFF14:
+		a.ch1.frequency = a.ch1.frequency&0xFF | uint16(v&0x07)<<8
+		if a.writeLengthEnable(&a.ch1.length, v, lengthClocking) && v&0x80 == 0 {
+			a.ch1.enabled = false
+		}
+		if v&0x80 != 0 {
+			a.triggerSquare(&a.ch1, lengthClocking)
+			a.ch1.sweepTrigger()
+		}
+
+	case 0xFF16:
+		a.ch2.duty = v >> 6
+		a.ch2.length.value = 64 - int(v&0x3F)
+	case 0xFF17:
+		a.ch2.envelope.write(v)
+		if !a.ch2.envelope.dacEnabled() {
+			a.ch2.enabled = false
+		}
+	case 0xFF18:
+		a.ch2.frequency = a.ch2.frequency&0x700 | uint16(v)
+	case 0xFF19:
+		a.ch2.frequency = a.ch2.frequency&0xFF | uint16(v&0x07)<<8
+		if a.writeLengthEnable(&a.ch2.length, v, lengthClocking) && v&0x80 == 0 {
+			a.ch2.enabled = false
+		}
+		if v&0x80 != 0 {
+			a.triggerSquare(&a.ch2, lengthClocking)
+		}
+
+	case 0xFF1A:
+		a.ch3.dacEnabled = v&0x80 != 0
+		if !a.ch3.dacEnabled {
+			a.ch3.enabled = false
+		}
+	case 0xFF1B:
+		a.ch3.length.value = 256 - int(v)
+	case 0xFF1C:
+		a.ch3.volume = (v >> 5) & 0x03
+	case 0xFF1D:
+		a.ch3.frequency = a.ch3.frequency&0x700 | uint16(v)
+	case 0xFF1E:
+		a.ch3.frequency = a.ch3.frequency&0xFF | uint16(v&0x07)<<8
+		if a.writeLengthEnable(&a.ch3.length, v, lengthClocking) && v&0x80 == 0 {
+			a.ch3.enabled = false
+		}
+		if v&0x80 != 0 {
+			a.triggerLength(&a.ch3.length, lengthClocking)
+			a.ch3.enabled = a.ch3.dacEnabled
+			a.ch3.position = 0
+			a.ch3.reload()
+		}
+
+	case 0xFF20:
+		a.ch4.length.value = 64 - int(v&0x3F)
+	case 0xFF21:
+		a.ch4.envelope.write(v)
+		if !a.ch4.envelope.dacEnabled() {
+			a.ch4.enabled = false
+		}
+	case 0xFF22:
+		a.ch4.clockShift = v >> 4
+		a.ch4.widthMode = v&0x08 != 0
+		a.ch4.divisor = v & 0x07
+	case 0xFF23:
+		if a.writeLengthEnable(&a.ch4.length, v, lengthClocking) && v&0x80 == 0 {
+			a.ch4.enabled = false
+		}
+		if v&0x80 != 0 {
+			a.triggerLength(&a.ch4.length, lengthClocking)
+			a.ch4.enabled = a.ch4.envelope.dacEnabled()
+			a.ch4.envelope.trigger()
+			a.ch4.lfsr = 0x7FFF
+			a.ch4.timer = a.ch4.period()
+		}
+
+	case 0xFF24:
+		a.nr50 = v
+	case 0xFF25:
+		a.nr51 = v
+	}
+}
+
+func (a *APU) writeLengthEnable(l *lengthCounter, v uint8, lengthClocking bool) bool {
+	wasEnabled := l.enabled
+	l.enabled = v&0x40 != 0
+	if !wasEnabled && l.enabled && lengthClocking {
+		return l.clock()
+	}
+	return false
+}
+
+func (a *APU) triggerLength(l *lengthCounter, lengthClocking bool) {
+	if l.value != 0 {
+		return
+	}
+	l.value = l.max
+	if l.enabled && lengthClocking {
+		l.value--
+	}
+}
+
+func (a *APU) triggerSquare(s *squareChannel, lengthClocking bool) {
+	a.triggerLength(&s.length, lengthClocking)
+	s.enabled = s.envelope.dacEnabled()
+	s.envelope.trigger()
+	s.reload()
+}
+
+func (a *APU) setPower(on bool) {
+	if a.power == on {
+		return
+	}
+	a.power = on
+	if on {
+		a.frameStep = 0
+		a.ch1.dutyPos = 0
+		a.ch2.dutyPos = 0
+		a.ch3.sample = 0
+		return
+	}
+	a.regs = [0x17]uint8{}
+	a.nr50 = 0
+	a.nr51 = 0
+	a.resetChannels()
+}
+
+func (a *APU) resetChannels() {
+	a.ch1 = squareChannel{length: lengthCounter{max: 64}}
+	a.ch2 = squareChannel{length: lengthCounter{max: 64}}
+	a.ch3 = waveChannel{length: lengthCounter{max: 256}, ram: a.ch3.ram}
+	a.ch4 = noiseChannel{length: lengthCounter{max: 64}}
+}
+
+func (a *APU) ClockFrameSequencer() {
+	if !a.power {
+		return
+	}
+	switch a.frameStep {
+	case 0, 4:
+		a.clockLengths()
+	case 2, 6:
+		a.clockLengths()
+		a.ch1.sweepClock()
+	case 7:
+		a.ch1.envelope.clock()
+		a.ch2.envelope.clock()
+		a.ch4.envelope.clock()
+	}
+	a.frameStep = (a.frameStep + 1) & 0x07
+	a.updateOutput()
+}
+
+func (a *APU) clockLengths() {
+	if a.ch1.length.clock() {
+		a.ch1.enabled = false
+	}
+	if a.ch2.length.clock() {
+		a.ch2.enabled = false
+	}
+	if a.ch3.length.clock() {
+		a.ch3.enabled = false
+	}
+	if a.ch4.length.clock() {
+		a.ch4.enabled = false
+	}
+}
+
+func (a *APU) Tick(cycles int) {
+	for cycles > 0 {
+		n := cycles
+		if a.power {
+			if a.ch1.enabled {
+				n = min(n, a.ch1.timer)
+			}
+			if a.ch2.enabled {
+				n = min(n, a.ch2.timer)
+			}
+			if a.ch3.enabled {
+				n = min(n, a.ch3.timer)
+			}
+			if a.ch4.enabled {
+				n = min(n, a.ch4.timer)
+			}
+			n = max(n, 1)
+			a.ch1.step(n)
+			a.ch2.step(n)
+			a.ch3.step(n)
+			a.ch4.step(n)
+		}
+		cycles -= n
+		a.time += uint64(n)
+		a.clock += uint64(n)
+		a.updateOutput()
+	}
+}
+
+func (a *APU) updateOutput() {
+	if a.sampleRate == 0 {
+		return
+	}
+	channels := a.channelMix()
+	var left, right float64
+	for ch, out := range channels {
+		if a.stems[ch] != nil {
+			a.stems[ch].update(a.time, out[0], out[1])
+		}
+		if a.channelAudible(ch) {
+			left += out[0]
+			right += out[1]
+		}
+	}
+	a.output.update(a.time, left, right)
+}
+
+func dacOutput(digital uint8, dacEnabled bool) float64 {
+	if !dacEnabled {
+		return 0
+	}
+	return 1 - float64(digital)/7.5
+}
+
+func (a *APU) channelOutputs() [4]float64 {
+	return [4]float64{
+		dacOutput(a.ch1.output(), a.ch1.envelope.dacEnabled()),
+		dacOutput(a.ch2.output(), a.ch2.envelope.dacEnabled()),
+		dacOutput(a.ch3.output(), a.ch3.dacEnabled),
+		dacOutput(a.ch4.output(), a.ch4.envelope.dacEnabled()),
+	}
+}
+
+func (a *APU) channelMix() [4][2]float64 {
+	var channels [4][2]float64
+	if !a.power {
+		return channels
+	}
+	leftVolume := float64((a.nr50>>4)&0x07+1) / 32
+	rightVolume := float64(a.nr50&0x07+1) / 32
+	for i, out := range a.channelOutputs() {
+		if a.nr51&(0x10<<i) != 0 {
+			channels[i][0] = out * leftVolume
+		}
+		if a.nr51&(0x01<<i) != 0 {
+			channels[i][1] = out * rightVolume
+		}
+	}
+	return channels
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+	"os"
+)
+
+const (
+	aviHeaderSize  = 324
+	aviMaxFileSize = 1 << 30
+	aviHasIndex    = 0x10
+	aviKeyframe    = 0x10
+	aviAudioAlign  = 4
+	aviVideoStream = "00db"
+	aviAudioStream = "01wb"
+)
+
+type AVIWriter struct {
+	w             io.WriteSeeker
+	file          *os.File
+	buf           *bufio.Writer
+	width, height int
+	sampleRate    int
+	frames        uint32
+	samples       uint32
+	moviSize      uint32
+	maxChunk      uint32
+	index         []byte
+	chunk         []byte
+}
+
+func NewAVIWriter(w io.WriteSeeker, width, height, sampleRate int) (*AVIWriter, error) {
+	a := &AVIWriter{w: w, width: width, height: height, sampleRate: sampleRate, moviSize: 4}
+	if _, err := w.Write(a.header()); err != nil {
+		return nil, err
+	}
+	a.buf = bufio.NewWriter(w)
+	return a, nil
+}
+
+func CreateAVI(path string, width, height, sampleRate int) (*AVIWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	a, err := NewAVIWriter(f, width, height, sampleRate)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	a.file = f
+	return a, nil
+}
+
+func (a *AVIWriter) stride() int {
+	return (a.width*3 + 3) &^ 3
+}
+
+func (a *AVIWriter) fileSize() int {
+	return aviHeaderSize - 4 + int(a.moviSize) + 8 + len(a.index)
+}
+
+func aviChunkSize(n int) int {
+	return 8 + n + n%2 + 16
+}
+
+func appendFourCC(b []byte, fourcc string, size int) []byte {
+	b = append(b, fourcc...)
+	return binary.LittleEndian.AppendUint32(b, uint32(size))
+}
+
+func appendList(b []byte, size int, kind string) []byte {
+	return append(appendFourCC(b, "LIST", size), kind...)
+}
+
+func appendU32(b []byte, vs ...uint32) []byte {
+	for _, v := range vs {
+		b = binary.LittleEndian.AppendUint32(b, v)
+	}
+	return b
+}
+
+func appendU16(b []byte, vs ...uint16) []byte {
+	for _, v := range vs {
+		b = binary.LittleEndian.AppendUint16(b, v)
+	}
+	return b
+}
+
+func (a *AVIWriter) header() []byte {
+	frameSize := uint32(a.stride() * a.height)
+
+	h := make([]byte, 0, aviHeaderSize)
+	h = appendFourCC(h, "RIFF", a.fileSize()-8)
+	h = append(h, "AVI "...)
+	h = appendList(h, 292, "hdrl")
+
+	h = appendFourCC(h, "avih", 56)
+	h = appendU32(h, 1000000*cyclesPerFrame/cpuClock, uint32(float64(frameSize)*frameRate)+uint32(a.sampleRate*aviAudioAlign),
+		0, aviHasIndex, a.frames, 0, 2, a.maxChunk, uint32(a.width), uint32(a.height), 0, 0, 0, 0)
+
+	h = appendList(h, 116, "strl")
+	h = appendFourCC(h, "strh", 56)
+	h = append(h, "vidsDIB "...)
+	h = appendU32(h, 0, 0, 0, cyclesPerFrame, cpuClock, 0, a.frames, frameSize, 0xFFFFFFFF, 0)
+	h = appendU16(h, 0, 0, uint16(a.width), uint16(a.height))
+	h = appendFourCC(h, "strf", 40)
+	h = appendU32(h, 40, uint32(a.width), uint32(a.height))
+	h = appendU16(h, 1, 24)
+	h = appendU32(h, 0, frameSize, 0, 0, 0, 0)
+
+	h = appendList(h, 92, "strl")
+	h = appendFourCC(h, "strh", 56)
+	h = append(h, "auds"...)
+	h = appendU32(h, 0, 0, 0, 0, 1, uint32(a.sampleRate), 0, a.samples, uint32(a.sampleRate*aviAudioAlign), 0xFFFFFFFF, aviAudioAlign)
+	h = appendU16(h, 0, 0, 0, 0)
+	h = appendFourCC(h, "strf", 16)
+	h = appendU16(h, 1, 2)
+	h = appendU32(h, uint32(a.sampleRate), uint32(a.sampleRate*aviAudioAlign))
+	h = appendU16(h, aviAudioAlign, 16)
+
+	h = appendList(h, int(a.moviSize), "movi")
+	return h
+}
+
+func (a *AVIWriter) writeChunk(fourcc string, data []byte) error {
+	a.index = append(a.index, fourcc...)
+	a.index = appendU32(a.index, aviKeyframe, a.moviSize, uint32(len(data)))
+
+	a.chunk = appendFourCC(a.chunk[:0], fourcc, len(data))
+	a.chunk = append(a.chunk, data...)
+	if len(data)%2 != 0 {
+		a.chunk = append(a.chunk, 0)
+	}
+	if _, err := a.buf.Write(a.chunk); err != nil {
+		return err
+	}
+	a.moviSize += uint32(len(a.chunk))
+	a.maxChunk = max(a.maxChunk, uint32(len(data)))
+	return nil
+}
+
+func (a *AVIWriter) WriteFrame(img *image.RGBA, samples []int16) error {
+	stride := a.stride()
+	size := a.fileSize() + aviChunkSize(stride*a.height)
+	if len(samples) > 0 {
+		size += aviChunkSize(len(samples) * 2)
+	}
+	if size > aviMaxFileSize {
+		return fmt.Errorf("avi: frame %d would exceed the %d byte AVI 1.0 limit", a.frames, aviMaxFileSize)
+	}
+
+	frame := make([]byte, stride*a.height)
+	for y := range a.height {
+		row := frame[(a.height-1-y)*stride:]
+		for x := range a.width {
+			c := img.RGBAAt(img.Rect.Min.X+x, img.Rect.Min.Y+y)
+			row[x*3], row[x*3+1], row[x*3+2] = c.B, c.G, c.R
+		}
+	}
+	if err := a.writeChunk(aviVideoStream, frame); err != nil {
+		return err
+	}
+	a.frames++
+
+	if len(samples) == 0 {
+		return nil
+	}
+	audio := make([]byte, 0, len(samples)*2)
+	for _, s := range samples {
+		audio = binary.LittleEndian.AppendUint16(audio, uint16(s))
+	}
+	a.samples += uint32(len(samples) / 2)
+	return a.writeChunk(aviAudioStream, audio)
+}
+
+func (a *AVIWriter) Close() error {
+	err := a.finish()
+	if a.file != nil {
+		if cerr := a.file.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func (a *AVIWriter) finish() error {
+	if _, err := a.buf.Write(appendFourCC(nil, "idx1", len(a.index))); err != nil {
+		return err
+	}
+	if _, err := a.buf.Write(a.index); err != nil {
+		return err
+	}
+	if err := a.buf.Flush(); err != nil {
+		return err
+	}
+	if _, err := a.w.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := a.w.Write(a.header())
+	return err
+}
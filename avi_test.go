@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/binary"
+	"image"
+	"os"
+	"testing"
+)
+
+func TestAVISizeLimit(t *testing.T) {
+	f, err := os.Create(t.TempDir() + "/limit.avi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	a, err := NewAVIWriter(f, 16, 16, 44100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	if err := a.WriteFrame(img, make([]int16, 4)); err != nil {
+		t.Fatal(err)
+	}
+
+	a.moviSize = uint32(aviMaxFileSize - a.fileSize() + int(a.moviSize) - aviChunkSize(a.stride()*16) + 1)
+	if err := a.WriteFrame(img, nil); err == nil {
+		t.Fatal("frame past the AVI 1.0 limit was accepted")
+	}
+	if a.frames != 1 {
+		t.Errorf("frames = %d after the rejected frame, want 1", a.frames)
+	}
+
+	a.moviSize--
+	if err := a.WriteFrame(img, nil); err != nil {
+		t.Fatalf("frame up to the limit: %v", err)
+	}
+	if size := a.fileSize(); size != aviMaxFileSize {
+		t.Errorf("file size = %d, want %d", size, aviMaxFileSize)
+	}
+	if got := binary.LittleEndian.Uint32(a.header()[4:]); got != aviMaxFileSize-8 {
+		t.Errorf("RIFF size = %d, want %d", got, aviMaxFileSize-8)
+	}
+
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte{0}); err != nil {
+		t.Errorf("Close closed the caller's file: %v", err)
+	}
+}
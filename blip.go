@@ -0,0 +1,132 @@
+package main
+
+import "math"
+
+const (
+	blipPhases = 64
+	blipTaps   = 16
+	blipCutoff = 0.9
+)
+
+var blipKernel = makeBlipKernel()
+
+func makeBlipKernel() [blipPhases][blipTaps]float64 {
+	var kernel [blipPhases][blipTaps]float64
+	for p := range blipPhases {
+		frac := float64(p) / blipPhases
+		sum := 0.0
+		for k := range blipTaps {
+			x := float64(k) - blipTaps/2 + 1 - frac
+			v := blipCutoff
+			if x != 0 {
+				v = math.Sin(math.Pi*blipCutoff*x) / (math.Pi * x)
+			}
+			w := 2 * math.Pi * x / blipTaps
+			v *= 0.42 + 0.5*math.Cos(w) + 0.08*math.Cos(2*w)
+			kernel[p][k] = v
+			sum += v
+		}
+		for k := range blipTaps {
+			kernel[p][k] /= sum
+		}
+	}
+	return kernel
+}
+
+type blipBuffer struct {
+	factor     float64
+	offset     float64
+	deltas     []float64
+	integrator float64
+}
+
+func newBlipBuffer(clockRate, sampleRate int) *blipBuffer {
+	return &blipBuffer{factor: float64(sampleRate) / float64(clockRate)}
+}
+
+func (b *blipBuffer) addDelta(clock uint64, delta float64) {
+	if delta == 0 {
+		return
+	}
+	pos := b.offset + float64(clock)*b.factor
+	i := int(pos)
+	phase := int((pos - float64(i)) * blipPhases)
+	if need := i + blipTaps; need > len(b.deltas) {
+		b.deltas = append(b.deltas, make([]float64, need-len(b.deltas))...)
+	}
+	for k, v := range blipKernel[phase] {
+		b.deltas[i+k] += delta * v
+	}
+}
+
+func (b *blipBuffer) endFrame(clocks uint64, dst []float64) []float64 {
+	end := b.offset + float64(clocks)*b.factor
+	count := int(end)
+	b.offset = end - float64(count)
+	if count > len(b.deltas) {
+		b.deltas = append(b.deltas, make([]float64, count-len(b.deltas))...)
+	}
+	for _, d := range b.deltas[:count] {
+		b.integrator += d
+		dst = append(dst, b.integrator)
+	}
+	b.deltas = append(b.deltas[:0], b.deltas[count:]...)
+	return dst
+}
+
+type highPass struct {
+	charge    float64
+	capacitor float64
+}
+
+func newHighPass(model Model, sampleRate int) highPass {
+	factor := 0.999958
+	if model == ModelCGB {
+		factor = 0.998943
+	}
+	return highPass{charge: math.Pow(factor, float64(cpuClock)/float64(sampleRate))}
+}
+
+func (h *highPass) filter(in float64) float64 {
+	out := in - h.capacitor
+	h.capacitor = in - out*h.charge
+	return out
+}
+
+type stereoStream struct {
+	blips    [2]*blipBuffer
+	highPass [2]highPass
+	last     [2]float64
+	mixed    [2][]float64
+}
+
+func newStereoStream(model Model, sampleRate int) *stereoStream {
+	s := &stereoStream{}
+	for i := range s.blips {
+		s.blips[i] = newBlipBuffer(cpuClock, sampleRate)
+		s.highPass[i] = newHighPass(model, sampleRate)
+	}
+	return s
+}
+
+func (s *stereoStream) update(clock uint64, left, right float64) {
+	s.blips[0].addDelta(clock, left-s.last[0])
+	s.blips[1].addDelta(clock, right-s.last[1])
+	s.last = [2]float64{left, right}
+}
+
+func (s *stereoStream) endFrame(clocks uint64, dst []int16) []int16 {
+	for i, b := range s.blips {
+		s.mixed[i] = b.endFrame(clocks, s.mixed[i][:0])
+	}
+	for i := range s.mixed[0] {
+		for side := range s.mixed {
+			dst = append(dst, toPCM16(s.highPass[side].filter(s.mixed[side][i])))
+		}
+	}
+	return dst
+}
+
+func toPCM16(v float64) int16 {
+	return int16(max(-32768, min(32767, math.Round(v*32767))))
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"math"
+	"math/cmplx"
+	"testing"
+)
+
+func fft(x []complex128) {
+	n := len(x)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j |= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+	for size := 2; size <= n; size <<= 1 {
+		w := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			wk := complex(1, 0)
+			for k := range size / 2 {
+				a, b := x[start+k], x[start+k+size/2]*wk
+				x[start+k], x[start+k+size/2] = a+b, a-b
+				wk *= w
+			}
+		}
+	}
+}
+
+func TestSquareWaveSpectrum(t *testing.T) {
+	const (
+		sampleRate = 44100
+		period     = 2000
+		n          = 1 << 15
+		settle     = sampleRate / 10
+	)
+	apu := NewAPU()
+	apu.SetSampleRate(sampleRate)
+	apu.Write(0xFF26, 0x80)
+	apu.Write(0xFF24, 0x77)
+	apu.Write(0xFF25, 0x22)
+	apu.Write(0xFF16, 0x80)
+	apu.Write(0xFF17, 0xF0)
+	apu.Write(0xFF18, period&0xFF)
+	apu.Write(0xFF19, 0x80|period>>8)
+
+	var left []float64
+	for len(left) < settle+n {
+		apu.Tick(cyclesPerFrame)
+		samples := apu.Samples()
+		for i := 0; i < len(samples); i += 2 {
+			left = append(left, float64(samples[i]))
+		}
+	}
+	left = left[settle : settle+n]
+
+	mean := 0.0
+	for _, v := range left {
+		mean += v / n
+	}
+	if math.Abs(mean) > 32767*0.01 {
+		t.Errorf("high-pass left a DC offset of %.1f", mean)
+	}
+
+	x := make([]complex128, n)
+	for i, v := range left {
+		window := 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/n)
+		x[i] = complex(v*window, 0)
+	}
+	fft(x)
+
+	f0 := 131072.0 / (2048 - period)
+	binWidth := float64(sampleRate) / n
+	var harmonic, other float64
+	for bin := 1; bin < n/2; bin++ {
+		power := real(x[bin])*real(x[bin]) + imag(x[bin])*imag(x[bin])
+		freq := float64(bin) * binWidth
+		k := math.Round(freq / f0)
+		if k >= 1 && math.Abs(freq-k*f0) <= 3*binWidth {
+			harmonic += power
+		} else {
+			other += power
+		}
+	}
+	db := 10 * math.Log10(other/harmonic)
+	t.Logf("energy outside harmonics: %.1f dB", db)
+	if db > -40 {
+		t.Errorf("energy outside harmonics is %.1f dB, want below -40 dB", db)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+func isCGBRegister(a uint16) bool {
+	switch {
+	case a == 0xFF4D || a == 0xFF4F || a == 0xFF70:
+		return true
+	case a >= 0xFF51 && a <= 0xFF55:
+		return true
+	case a >= 0xFF68 && a <= 0xFF6B:
+		return true
+	}
+	return false
+}
+
+func (m *MMU) readCGB(a uint16) uint8 {
+	if !m.cgb {
+		return 0xFF
+	}
+	switch a {
+	case 0xFF4D:
+		v := uint8(0x7E)
+		if m.doubleSpeed {
+			v |= 0x80
+		}
+		if m.prepare {
+			v |= 0x01
+		}
+		return v
+	case 0xFF4F:
+		return 0xFE | m.vbk
+	case 0xFF70:
+		return 0xF8 | m.svbk
+	case 0xFF51, 0xFF52, 0xFF53, 0xFF54, 0xFF55:
+		return m.readHDMA(a)
+	case 0xFF68:
+		return m.bgPalette.readSpec()
+	case 0xFF69:
+		return m.bgPalette.readData()
+	case 0xFF6A:
+		return m.objPalette.readSpec()
+	case 0xFF6B:
+		return m.objPalette.readData()
+	}
+	return 0xFF
+}
+
+func (m *MMU) writeCGB(a uint16, v uint8) {
+	if !m.cgb {
+		return
+	}
+	switch a {
+	case 0xFF4D:
+		m.prepare = v&0x01 != 0
+	case 0xFF4F:
+		m.vbk = v & 0x01
+	case 0xFF70:
+		m.svbk = v & 0x07
+	case 0xFF51, 0xFF52, 0xFF53, 0xFF54, 0xFF55:
+		m.writeHDMA(a, v)
+	case 0xFF68:
+		m.bgPalette.writeSpec(v)
+	case 0xFF69:
+		m.bgPalette.writeData(v)
+	case 0xFF6A:
+		m.objPalette.writeSpec(v)
+	case 0xFF6B:
+		m.objPalette.writeData(v)
+	}
+}
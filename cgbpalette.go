@@ -0,0 +1,40 @@
+package main
+
+import "image/color"
+
+type cgbPalette struct {
+	spec uint8
+	data [64]uint8
+}
+
+func (p *cgbPalette) readSpec() uint8 {
+	return p.spec | 0x40
+}
+
+func (p *cgbPalette) writeSpec(v uint8) {
+	p.spec = v & 0xBF
+}
+
+func (p *cgbPalette) readData() uint8 {
+	return p.data[p.spec&0x3F]
+}
+
+func (p *cgbPalette) writeData(v uint8) {
+	p.data[p.spec&0x3F] = v
+	if p.spec&0x80 != 0 {
+		p.spec = 0x80 | (p.spec+1)&0x3F
+	}
+}
+
+func (p *cgbPalette) Color(palette, index int) uint16 {
+	offset := palette*8 + index*2
+	return uint16(p.data[offset]) | uint16(p.data[offset+1])<<8
+}
+
+func RGB555ToRGBA(c uint16) color.RGBA {
+	expand := func(v uint16) uint8 {
+		v &= 0x1F
+		return uint8(v<<3 | v>>2)
+	}
+	return color.RGBA{R: expand(c), G: expand(c >> 5), B: expand(c >> 10), A: 0xFF}
+}
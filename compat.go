@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+type CompatPalettes struct {
+	BG   [4]uint32
+	OBJ0 [4]uint32
+	OBJ1 [4]uint32
+}
+
+const defaultCompatPalette = "right+a"
+
+var (
+	compatRed   = [4]uint32{0xFFFFFF, 0xFF8484, 0x943A3A, 0x000000}
+	compatGreen = [4]uint32{0xFFFFFF, 0x7BFF31, 0x008400, 0x000000}
+	compatBlue  = [4]uint32{0xFFFFFF, 0x63A5FF, 0x0000FF, 0x000000}
+	compatBrown = [4]uint32{0xFFFFFF, 0xFFAD63, 0x843100, 0x000000}
+)
+
+var compatManualPalettes = map[string]CompatPalettes{
+	"up":      uniformCompat(compatBrown),
+	"up+a":    {BG: compatRed, OBJ0: compatGreen, OBJ1: compatBlue},
+	"up+b":    uniformCompat([4]uint32{0xFFE6C5, 0xCE9C84, 0x846B29, 0x5A3108}),
+	"left":    {BG: compatBlue, OBJ0: compatRed, OBJ1: compatGreen},
+	"left+a":  {BG: [4]uint32{0xFFFFFF, 0x8C8CDE, 0x52528C, 0x000000}, OBJ0: compatRed, OBJ1: compatBrown},
+	"left+b":  uniformCompat([4]uint32{0xFFFFFF, 0xA5A5A5, 0x525252, 0x000000}),
+	"down":    uniformCompat([4]uint32{0xFFFFA5, 0xFF9494, 0x9494FF, 0x000000}),
+	"down+a":  uniformCompat([4]uint32{0xFFFFFF, 0xFFFF00, 0xFF0000, 0x000000}),
+	"down+b":  {BG: [4]uint32{0xFFFFFF, 0xFFFF00, 0x7B4A00, 0x000000}, OBJ0: compatBlue, OBJ1: compatGreen},
+	"right":   uniformCompat([4]uint32{0xFFFFFF, 0x52FF00, 0xFF4200, 0x000000}),
+	"right+a": {BG: [4]uint32{0xFFFFFF, 0x7BFF31, 0x0063C5, 0x000000}, OBJ0: compatRed, OBJ1: compatRed},
+	"right+b": uniformCompat([4]uint32{0x000000, 0x008484, 0xFFDE00, 0xFFFFFF}),
+}
+
+func uniformCompat(p [4]uint32) CompatPalettes {
+	return CompatPalettes{BG: p, OBJ0: p, OBJ1: p}
+}
+
+func SelectCompatPalettes(selection string) (CompatPalettes, error) {
+	selection = strings.ToLower(selection)
+	if selection == "" || selection == "auto" {
+		selection = defaultCompatPalette
+	}
+	p, ok := compatManualPalettes[selection]
+	if !ok {
+		return CompatPalettes{}, fmt.Errorf("unknown compatibility palette %q", selection)
+	}
+	return p, nil
+}
+
+func rgb888To555(c uint32) uint16 {
+	r := uint16(c>>16&0xFF) >> 3
+	g := uint16(c>>8&0xFF) >> 3
+	b := uint16(c&0xFF) >> 3
+	return r | g<<5 | b<<10
+}
+
+func loadCompatPalette(p *cgbPalette, palette int, colors [4]uint32) {
+	for i, c := range colors {
+		v := rgb888To555(c)
+		p.data[palette*8+i*2] = uint8(v)
+		p.data[palette*8+i*2+1] = uint8(v >> 8)
+	}
+}
+
+func (m *MMU) SetCompatPalettes(p CompatPalettes) {
+	loadCompatPalette(&m.bgPalette, 0, p.BG)
+	loadCompatPalette(&m.objPalette, 0, p.OBJ0)
+	loadCompatPalette(&m.objPalette, 1, p.OBJ1)
+}
+
+func (g *GameBoy) SetCompatPalette(selection string) error {
+	p, err := SelectCompatPalettes(selection)
+	if err != nil {
+		return err
+	}
+	if g.MMU.model == ModelCGB && !g.MMU.cgb {
+		g.MMU.SetCompatPalettes(p)
+	}
+	return nil
+}
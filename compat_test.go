@@ -0,0 +1,37 @@
+package main
+
+import "testing"
+
+func TestCompatPalettes(t *testing.T) {
+	rom := make([]byte, 0x8000)
+	gb := NewGameBoy(rom, ModelCGB)
+	if got, want := gb.MMU.BGColor(0, 1), rgb888To555(0x7BFF31); got != want {
+		t.Errorf("default BG color 1 = %04X, want %04X", got, want)
+	}
+
+	if err := gb.SetCompatPalette("Up+A"); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		name string
+		got  uint16
+		want uint32
+	}{
+		{"BG", gb.MMU.BGColor(0, 2), 0x943A3A},
+		{"OBJ0", gb.MMU.OBJColor(0, 2), 0x008400},
+		{"OBJ1", gb.MMU.OBJColor(1, 2), 0x0000FF},
+	} {
+		if c.got != rgb888To555(c.want) {
+			t.Errorf("up+a %s color 2 = %04X, want %04X", c.name, c.got, rgb888To555(c.want))
+		}
+	}
+
+	if err := gb.SetCompatPalette("up+start"); err == nil {
+		t.Error("unknown combo accepted")
+	}
+
+	rom[0x143] = 0x80
+	if got := NewGameBoy(rom, ModelCGB).MMU.BGColor(0, 1); got != 0 {
+		t.Errorf("CGB cartridge got compatibility palette %04X", got)
+	}
+}
@@ -1,9 +1,15 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"image"
 	"log"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type CPU struct {
@@ -21,7 +27,8 @@ type CPU struct {
 	bus            Memory
 	instructions   [256]Instruction
 	cbInstructions [256]Instruction
-	duration       int
+	ticker         busTicker
+	cycles         int
 }
 
 func NewCPU(bus Memory) *CPU {
@@ -32,6 +39,7 @@ func NewCPU(bus Memory) *CPU {
 		PC:  0x100,
 		bus: bus,
 	}
+	cpu.ticker, _ = bus.(busTicker)
 	cpu.initInstructions()
 	return cpu
 }
@@ -66,7 +74,7 @@ func (c *CPU) GetReg8(id int) uint8 {
 	case 5:
 		return c.L
 	case 6:
-		return c.bus.Read(c.ReadHL())
+		return c.read(c.ReadHL())
 	case 7:
 		return c.A
 	}
@@ -88,7 +96,7 @@ func (c *CPU) WriteReg8(id int, v uint8) {
 	case 5:
 		c.L = v
 	case 6:
-		c.bus.Write(c.ReadHL(), v)
+		c.write(c.ReadHL(), v)
 	case 7:
 		c.A = v
 	}
@@ -198,15 +206,31 @@ func (c *CPU) ExecuteALU(op int, val uint8) {
 }
 
 func (c *CPU) Step() int {
-	c.duration = 0
+	c.cycles = 0
 	opcode := c.fetchByte()
-	ins := c.instructions[opcode]
-	ins.Method(c)
-	return ins.Cycles + c.duration
+	c.instructions[opcode].Method(c)
+	return c.cycles
+}
+
+func (c *CPU) idle() {
+	c.cycles += 4
+	if c.ticker != nil {
+		c.ticker.Tick(4)
+	}
+}
+
+func (c *CPU) read(addr uint16) uint8 {
+	c.idle()
+	return c.bus.Read(addr)
+}
+
+func (c *CPU) write(addr uint16, v uint8) {
+	c.idle()
+	c.bus.Write(addr, v)
 }
 
 func (c *CPU) fetchByte() uint8 {
-	opcode := c.bus.Read(c.PC)
+	opcode := c.read(c.PC)
 	c.PC++
 	return opcode
 }
@@ -218,16 +242,17 @@ func (c *CPU) fetchWord() uint16 {
 }
 
 func (c *CPU) push(val uint16) {
+	c.idle()
 	c.SP--
-	c.bus.Write(c.SP, uint8(val>>8))
+	c.write(c.SP, uint8(val>>8))
 	c.SP--
-	c.bus.Write(c.SP, uint8(val))
+	c.write(c.SP, uint8(val))
 }
 
 func (c *CPU) pop() uint16 {
-	l := c.bus.Read(c.SP)
+	l := c.read(c.SP)
 	c.SP++
-	h := c.bus.Read(c.SP)
+	h := c.read(c.SP)
 	c.SP++
 	return uint16(h)<<8 | uint16(l)
 }
@@ -312,23 +337,320 @@ func (c *CPU) executeCBShift(op int, val uint8) (uint8, uint8) {
 }
 
 func main() {
-	mmu := &MMU{}
-	cpu := NewCPU(mmu)
+	romPath := flag.String("rom", "cpu_instrs.gb", "path to the cartridge ROM")
+	modelName := flag.String("model", "dmg", "hardware model to emulate: dmg, cgb or sgb")
+	compatPalette := flag.String("compat-palette", "auto", "palette for DMG cartridges on cgb: auto, or a boot button combo like up+a or right+b")
+	linkListen := flag.String("link-listen", "", "wait for a link cable peer on tcp:host:port or unix:path")
+	linkConnect := flag.String("link-connect", "", "connect the link cable to a peer on tcp:host:port or unix:path")
+	printerDir := flag.String("printer", "", "attach a Game Boy Printer that writes PNG prints to this directory")
+	players := flag.Int("players", 1, "number of instances (2-4 are linked through a DMG-07 four player adapter)")
+	wavPath := flag.String("wav", "", "record the mixed audio output to this WAV file")
+	sampleRate := flag.Int("sample-rate", 48000, "audio output sample rate in Hz")
+	mute := flag.String("mute", "", "comma-separated APU channels (1-4) to mute")
+	solo := flag.String("solo", "", "comma-separated APU channels (1-4) to solo")
+	stemsPrefix := flag.String("stems", "", "also record each APU channel to <prefix>-chN.wav")
+	frames := flag.Int("frames", 0, "stop after this many frames (0 runs until interrupted)")
+	vgmPath := flag.String("vgm", "", "log APU register writes to this VGM file")
+	gbsPath := flag.String("gbs", "", "render a GBS sound rip to the -wav file instead of running a ROM")
+	track := flag.Int("track", 0, "GBS track number to render (0 plays the file's first song)")
+	screenshotPath := flag.String("screenshot", "", "save the last frame to this PNG file on exit")
+	scale := flag.Int("scale", 1, "integer scale factor for saved images")
+	videoPath := flag.String("record", "", "record video to a .gif, .y4m or .rgb file, or - for Y4M on stdout")
+	aviPath := flag.String("avi", "", "record uncompressed video and audio to this AVI file")
+	terminalMode := flag.String("terminal", "", "play in the terminal with truecolor or 256 color ANSI output")
+	vramPrefix := flag.String("dump-vram", "", "save tile, map and OAM viewer images to <prefix>-*.png on exit")
+	filterSpec := flag.String("filter", "", "comma-separated filters for saved and displayed frames: nearest[:n], scale2x, scale3x, grid[:n], correct, blend[:weight]")
+	paletteName := flag.String("palette", "grayscale", "DMG palette for saved images: grayscale, green, or four RRGGBB colors")
+	flag.Parse()
+
+	if *gbsPath != "" {
+		if err := renderGBS(*gbsPath, *track, *wavPath, *vgmPath, *sampleRate, *frames); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	rom, err := os.ReadFile(*romPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *players > 1 {
+		roms := make([][]byte, *players)
+		for i := range roms {
+			roms[i] = rom
+		}
+		fp, err := NewFourPlayer(roms...)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Println("--- System Start ---")
 
-	rom, err := os.ReadFile("cpu_instrs.gb")
+		for {
+			fp.Run(fourPlayerRunQuantum)
+		}
+	}
+
+	model, err := ParseModel(*modelName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	gb := NewGameBoy(rom, model)
+	if err := gb.SetCompatPalette(*compatPalette); err != nil {
+		log.Fatal(err)
+	}
+	palette, err := ParseDMGPalette(*paletteName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	filters, err := ParseFilters(*filterSpec)
 	if err != nil {
 		log.Fatal(err)
 	}
-	mmu.LoadCartridge(rom)
+	render := func() *image.RGBA {
+		return ApplyFilters(gb.Image(palette, *scale), filters)
+	}
+	var last *image.RGBA
+	if *screenshotPath != "" {
+		defer func() {
+			if last == nil {
+				last = render()
+			}
+			if err := SavePNG(*screenshotPath, last); err != nil {
+				log.Print(err)
+			}
+		}()
+	}
+	if *vramPrefix != "" {
+		defer func() {
+			if err := gb.MMU.DumpVRAM(*vramPrefix, palette); err != nil {
+				log.Print(err)
+			}
+		}()
+	}
+
+	var printer *Printer
+	switch {
+	case *linkListen != "":
+		conn, err := ListenLink(*linkListen)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer NewNetLink(conn, gb.MMU.Serial()).Close()
+	case *linkConnect != "":
+		conn, err := DialLink(*linkConnect)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer NewNetLink(conn, gb.MMU.Serial()).Close()
+	case *printerDir != "":
+		printer = NewPrinter(*printerDir)
+		gb.MMU.Serial().Connect(printer)
+	}
+
+	apu := gb.MMU.APU()
+	if err := forEachChannel(*mute, func(ch int) { apu.SetChannelMuted(ch, true) }); err != nil {
+		log.Fatal(err)
+	}
+	if err := forEachChannel(*solo, func(ch int) { apu.SetChannelSolo(ch, true) }); err != nil {
+		log.Fatal(err)
+	}
+	if *wavPath != "" || *stemsPrefix != "" || *aviPath != "" {
+		apu.SetSampleRate(*sampleRate)
+	}
+
+	var wav *WAVWriter
+	if *wavPath != "" {
+		wav, err = CreateWAV(*wavPath, *sampleRate, 2)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer wav.Close()
+	}
 
-	cpu.PC = 0x0100
+	var stems [4]*WAVWriter
+	if *stemsPrefix != "" {
+		apu.EnableStems(true)
+		for ch := range stems {
+			stems[ch], err = CreateWAV(fmt.Sprintf("%s-ch%d.wav", *stemsPrefix, ch+1), *sampleRate, 2)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer stems[ch].Close()
+		}
+	}
+
+	if *vgmPath != "" {
+		vgm, err := CreateVGM(*vgmPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		apu.LogVGM(vgm)
+		defer func() {
+			if err := apu.StopVGM(); err != nil {
+				log.Print(err)
+			}
+		}()
+	}
+
+	var video VideoRecorder
+	if *videoPath != "" {
+		video, err = CreateVideoRecorder(*videoPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer func() {
+			if err := video.Close(); err != nil {
+				log.Print(err)
+			}
+		}()
+	}
+
+	var avi *AVIWriter
+	if *aviPath != "" {
+		size := FilteredBounds(gb.Image(palette, *scale), filters)
+		avi, err = CreateAVI(*aviPath, size.Dx(), size.Dy(), *sampleRate)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer func() {
+			if err := avi.Close(); err != nil {
+				log.Print(err)
+			}
+		}()
+	}
+
+	var term *TerminalRenderer
+	var pace <-chan time.Time
+	switch *terminalMode {
+	case "":
+	case "truecolor", "256":
+		term = NewTerminalRenderer(os.Stdout, *terminalMode == "truecolor")
+		defer term.Close()
+		if err := term.StartInput(os.Stdin); err != nil {
+			log.Fatal(err)
+		}
+		ticker := time.NewTicker(time.Second * cyclesPerFrame / cpuClock)
+		defer ticker.Stop()
+		pace = ticker.C
+	default:
+		log.Fatalf("unknown terminal mode %q, want truecolor or 256", *terminalMode)
+	}
+
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt)
+
+	if *videoPath != "-" && term == nil {
+		fmt.Println("--- System Start ---")
+	}
+
+	for frame := 0; *frames == 0 || frame < *frames; frame++ {
+		select {
+		case <-interrupted:
+			return
+		default:
+		}
+
+		if term != nil {
+			<-pace
+			if !term.Poll(gb.MMU.Joypad()) {
+				return
+			}
+		}
+
+		gb.RunFrame()
+		if printer != nil && printer.Err() != nil {
+			log.Print(printer.Err())
+			return
+		}
 
-	fmt.Println("--- System Start ---")
+		var img *image.RGBA
+		if term != nil || video != nil || avi != nil || *screenshotPath != "" {
+			img = render()
+			last = img
+		}
+		if term != nil {
+			if err := term.Draw(img); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if video != nil {
+			if err := video.WriteFrame(img); err != nil {
+				log.Fatal(err)
+			}
+		}
 
-	for {
+		samples := apu.Samples()
+		if avi != nil {
+			if err := avi.WriteFrame(img, samples); err != nil {
+				log.Print(err)
+				return
+			}
+		}
+		if wav != nil {
+			if err := wav.Write(samples); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if *stemsPrefix != "" {
+			for ch, stem := range apu.Stems() {
+				if err := stems[ch].Write(stem); err != nil {
+					log.Fatal(err)
+				}
+			}
+		}
+	}
+}
 
-		cycles := cpu.Step()
+func forEachChannel(list string, fn func(ch int)) error {
+	if list == "" {
+		return nil
+	}
+	for _, field := range strings.Split(list, ",") {
+		ch, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || ch < 1 || ch > 4 {
+			return fmt.Errorf("invalid APU channel %q, want 1-4", field)
+		}
+		fn(ch - 1)
+	}
+	return nil
+}
 
-		_ = cycles
+func renderGBS(path string, track int, wavPath, vgmPath string, sampleRate, frames int) (err error) {
+	if wavPath == "" || frames <= 0 {
+		return fmt.Errorf("-gbs needs -wav and -frames")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	gbs, err := ParseGBS(data)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(wavPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	player := NewGBSPlayer(gbs, sampleRate)
+	if vgmPath != "" {
+		vgm, err := CreateVGM(vgmPath)
+		if err != nil {
+			return err
+		}
+		player.LogVGM(vgm)
+		defer func() {
+			if cerr := player.MMU.APU().StopVGM(); err == nil {
+				err = cerr
+			}
+		}()
+	}
+	track--
+	if track < 0 {
+		track = gbs.DefaultTrack()
 	}
+	fmt.Printf("%s - %s (track %d/%d)\n", gbs.Header.Title, gbs.Header.Author, track+1, gbs.Header.Songs)
+	return player.RenderWAV(f, track, frames)
 }
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	lcdGamma        = 4.0
+	outputGamma     = 2.2
+	lcdGridScale    = 3
+	lcdGridShade    = 0.75
+	frameBlendMix   = 0.5
+	maxFilterFactor = 8
+)
+
+type Filter interface {
+	Apply(img *image.RGBA) *image.RGBA
+}
+
+func ParseFilters(spec string) ([]Filter, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	var filters []Filter
+	for _, field := range strings.Split(spec, ",") {
+		name, arg, _ := strings.Cut(strings.ToLower(strings.TrimSpace(field)), ":")
+		var f Filter
+		var err error
+		switch name {
+		case "nearest":
+			var n int
+			n, err = filterFactor(arg, 2)
+			f = NearestFilter{Scale: n}
+		case "scale2x":
+			f = ScaleXFilter{Scale: 2}
+		case "scale3x":
+			f = ScaleXFilter{Scale: 3}
+		case "grid":
+			var n int
+			n, err = filterFactor(arg, lcdGridScale)
+			f = LCDGridFilter{Scale: n}
+		case "correct":
+			f = ColorCorrection{}
+		case "blend":
+			mix := frameBlendMix
+			if arg != "" {
+				mix, err = strconv.ParseFloat(arg, 64)
+				if err == nil && (mix < 0 || mix > 1) {
+					err = fmt.Errorf("blend weight %v outside 0-1", mix)
+				}
+			}
+			f = &FrameBlend{Mix: mix}
+		default:
+			return nil, fmt.Errorf("unknown filter %q, want nearest, scale2x, scale3x, grid, correct or blend", name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("filter %q: %v", field, err)
+		}
+		filters = append(filters, f)
+	}
+	return filters, nil
+}
+
+func filterFactor(arg string, def int) (int, error) {
+	if arg == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 1 || n > maxFilterFactor {
+		return 0, fmt.Errorf("scale %q outside 1-%d", arg, maxFilterFactor)
+	}
+	return n, nil
+}
+
+func ApplyFilters(img *image.RGBA, filters []Filter) *image.RGBA {
+	for _, f := range filters {
+		img = f.Apply(img)
+	}
+	return img
+}
+
+func FilteredBounds(img *image.RGBA, filters []Filter) image.Rectangle {
+	for _, f := range filters {
+		if _, ok := f.(*FrameBlend); ok {
+			continue
+		}
+		img = f.Apply(img)
+	}
+	return img.Bounds()
+}
+
+type NearestFilter struct {
+	Scale int
+}
+
+func (f NearestFilter) Apply(img *image.RGBA) *image.RGBA {
+	return scaleImage(img, f.Scale)
+}
+
+type ScaleXFilter struct {
+	Scale int
+}
+
+func (f ScaleXFilter) Apply(img *image.RGBA) *image.RGBA {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w*f.Scale, h*f.Scale))
+	at := func(x, y int) color.RGBA {
+		return img.RGBAAt(b.Min.X+max(0, min(w-1, x)), b.Min.Y+max(0, min(h-1, y)))
+	}
+	for y := range h {
+		for x := range w {
+			a, bb, c := at(x-1, y-1), at(x, y-1), at(x+1, y-1)
+			d, e, ff := at(x-1, y), at(x, y), at(x+1, y)
+			g, hh, i := at(x-1, y+1), at(x, y+1), at(x+1, y+1)
+			var out []color.RGBA
+			if f.Scale == 2 {
+				out = scale2x(bb, d, e, ff, hh)
+			} else {
+				out = scale3x(a, bb, c, d, e, ff, g, hh, i)
+			}
+			for k, px := range out {
+				dst.SetRGBA(x*f.Scale+k%f.Scale, y*f.Scale+k/f.Scale, px)
+			}
+		}
+	}
+	return dst
+}
+
+func scale2x(b, d, e, f, h color.RGBA) []color.RGBA {
+	out := []color.RGBA{e, e, e, e}
+	if b != h && d != f {
+		if d == b {
+			out[0] = d
+		}
+		if b == f {
+			out[1] = f
+		}
+		if d == h {
+			out[2] = d
+		}
+		if h == f {
+			out[3] = f
+		}
+	}
+	return out
+}
+
+func scale3x(a, b, c, d, e, f, g, h, i color.RGBA) []color.RGBA {
+	out := []color.RGBA{e, e, e, e, e, e, e, e, e}
+	if b == h || d == f {
+		return out
+	}
+	if d == b {
+		out[0] = d
+	}
+	if (d == b && e != c) || (b == f && e != a) {
+		out[1] = b
+	}
+	if b == f {
+		out[2] = f
+	}
+	if (d == b && e != g) || (d == h && e != a) {
+		out[3] = d
+	}
+	if (b == f && e != i) || (h == f && e != c) {
+		out[5] = f
+	}
+	if d == h {
+		out[6] = d
+	}
+	if (d == h && e != i) || (h == f && e != g) {
+		out[7] = h
+	}
+	if h == f {
+		out[8] = f
+	}
+	return out
+}
+
+type LCDGridFilter struct {
+	Scale int
+}
+
+func (f LCDGridFilter) Apply(img *image.RGBA) *image.RGBA {
+	dst := scaleImage(img, f.Scale)
+	if f.Scale < 2 {
+		return dst
+	}
+	for y := range dst.Rect.Dy() {
+		for x := range dst.Rect.Dx() {
+			if x%f.Scale != f.Scale-1 && y%f.Scale != f.Scale-1 {
+				continue
+			}
+			c := dst.RGBAAt(x, y)
+			dst.SetRGBA(x, y, color.RGBA{
+				R: uint8(float64(c.R) * lcdGridShade),
+				G: uint8(float64(c.G) * lcdGridShade),
+				B: uint8(float64(c.B) * lcdGridShade),
+				A: c.A,
+			})
+		}
+	}
+	return dst
+}
+
+type ColorCorrection struct{}
+
+func (ColorCorrection) Apply(img *image.RGBA) *image.RGBA {
+	dst := image.NewRGBA(img.Bounds())
+	cache := map[color.RGBA]color.RGBA{}
+	for i := 0; i < len(img.Pix); i += 4 {
+		c := color.RGBA{R: img.Pix[i], G: img.Pix[i+1], B: img.Pix[i+2], A: img.Pix[i+3]}
+		out, ok := cache[c]
+		if !ok {
+			out = correctColor(c)
+			cache[c] = out
+		}
+		copy(dst.Pix[i:], []uint8{out.R, out.G, out.B, out.A})
+	}
+	return dst
+}
+
+func correctColor(c color.RGBA) color.RGBA {
+	lr := math.Pow(float64(c.R)/255, lcdGamma)
+	lg := math.Pow(float64(c.G)/255, lcdGamma)
+	lb := math.Pow(float64(c.B)/255, lcdGamma)
+	mix := func(r, g, b float64) uint8 {
+		v := math.Pow((r*lr+g*lg+b*lb)/255, 1/outputGamma) * 255 * 255 / 280
+		return uint8(max(0, min(255, math.Round(v))))
+	}
+	return color.RGBA{
+		R: mix(255, 50, 0),
+		G: mix(10, 230, 30),
+		B: mix(50, 10, 220),
+		A: c.A,
+	}
+}
+
+type FrameBlend struct {
+	Mix  float64
+	prev *image.RGBA
+}
+
+func (f *FrameBlend) Apply(img *image.RGBA) *image.RGBA {
+	prev := f.prev
+	f.prev = image.NewRGBA(img.Bounds())
+	copy(f.prev.Pix, img.Pix)
+	if prev == nil || prev.Rect != img.Rect {
+		return img
+	}
+	dst := image.NewRGBA(img.Bounds())
+	for i, v := range img.Pix {
+		dst.Pix[i] = uint8(math.Round(float64(v)*(1-f.Mix) + float64(prev.Pix[i])*f.Mix))
+	}
+	return dst
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"image"
+	"testing"
+)
+
+func TestFilteredBoundsLeavesBlendState(t *testing.T) {
+	filters, err := ParseFilters("nearest:2,blend,scale3x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := image.NewRGBA(image.Rect(0, 0, ScreenWidth, ScreenHeight))
+	if got, want := FilteredBounds(img, filters), image.Rect(0, 0, ScreenWidth*6, ScreenHeight*6); got != want {
+		t.Errorf("bounds = %v, want %v", got, want)
+	}
+	if blend := filters[1].(*FrameBlend); blend.prev != nil {
+		t.Error("probing the output size fed a frame to the blend filter")
+	}
+}
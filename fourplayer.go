@@ -0,0 +1,219 @@
+package main
+
+import "fmt"
+
+const (
+	fourPlayerPing = iota
+	fourPlayerStart
+	fourPlayerTransmit
+)
+
+const (
+	fourPlayerPingHeader  = 0xFE
+	fourPlayerAck         = 0x88
+	fourPlayerStartReq    = 0xAA
+	fourPlayerStartAck    = 0xCC
+	fourPlayerRestartReq  = 0xFF
+	fourPlayerPingDelay   = 12288
+	fourPlayerRateBase    = 1024
+	fourPlayerRateStep    = 768
+	fourPlayerRunQuantum  = 64
+	fourPlayerPacketBytes = 4
+)
+
+type FourPlayerAdapter struct {
+	players   [4]*Serial
+	connected uint8
+	acked     uint8
+	phase     int
+	position  int
+	counter   int
+	rate      uint8
+	size      uint8
+	requests  int
+	inbound   [4][]byte
+	outbound  []byte
+}
+
+func NewFourPlayerAdapter() *FourPlayerAdapter {
+	return &FourPlayerAdapter{counter: fourPlayerPingDelay, acked: 0x0F}
+}
+
+func (a *FourPlayerAdapter) Connect(player int, s *Serial) {
+	a.players[player] = s
+}
+
+func (a *FourPlayerAdapter) packetSize() int {
+	return max(int(a.size), 1)
+}
+
+func (a *FourPlayerAdapter) interval() int {
+	if a.phase == fourPlayerTransmit {
+		return serialTransferCycles + fourPlayerRateBase + int(a.rate&0x0F)*fourPlayerRateStep
+	}
+	return serialTransferCycles + fourPlayerPingDelay
+}
+
+func (a *FourPlayerAdapter) Tick(cycles int) {
+	a.counter -= cycles
+	for a.counter <= 0 {
+		a.transfer()
+		a.counter += a.interval()
+	}
+}
+
+func (a *FourPlayerAdapter) exchange(player int, out uint8) uint8 {
+	if a.players[player] == nil {
+		return 0xFF
+	}
+	return a.players[player].Receive(out)
+}
+
+func (a *FourPlayerAdapter) transfer() {
+	switch a.phase {
+	case fourPlayerPing:
+		a.ping()
+	case fourPlayerStart:
+		for p := range a.players {
+			a.exchange(p, fourPlayerStartAck)
+		}
+		a.position++
+		if a.position == fourPlayerPacketBytes {
+			a.beginTransmission()
+		}
+	case fourPlayerTransmit:
+		a.transmit()
+	}
+}
+
+func (a *FourPlayerAdapter) ping() {
+	for p := range a.players {
+		out := uint8(fourPlayerPingHeader)
+		if a.position > 0 {
+			out = a.connected<<4 | uint8(p+1)
+		}
+		in := a.exchange(p, out)
+
+		if p == 0 {
+			if in == fourPlayerStartReq {
+				a.requests++
+			} else {
+				a.requests = 0
+			}
+		}
+		if p == 0 && in == fourPlayerStartReq {
+			continue
+		}
+		switch a.position {
+		case 0, 1:
+			if in != fourPlayerAck {
+				a.acked &^= 1 << p
+			}
+		case 2:
+			if p == 0 {
+				a.rate = in
+			}
+		case 3:
+			if p == 0 {
+				a.size = in
+			}
+		}
+	}
+
+	a.position++
+	if a.position < fourPlayerPacketBytes {
+		return
+	}
+	a.position = 0
+	acked := a.acked
+	a.acked = 0x0F
+
+	if a.requests >= fourPlayerPacketBytes && a.connected&0x01 != 0 {
+		a.requests = 0
+		a.phase = fourPlayerStart
+		return
+	}
+	a.connected = acked
+}
+
+func (a *FourPlayerAdapter) beginTransmission() {
+	size := a.packetSize()
+	a.phase = fourPlayerTransmit
+	a.position = 0
+	a.requests = 0
+	a.outbound = make([]byte, 4*size)
+	for p := range a.inbound {
+		a.inbound[p] = make([]byte, size)
+	}
+}
+
+func (a *FourPlayerAdapter) transmit() {
+	size := a.packetSize()
+	out := a.outbound[a.position]
+
+	for p := range a.players {
+		in := a.exchange(p, out)
+		if a.position < size {
+			a.inbound[p][a.position] = in
+		}
+		if p == 0 {
+			if in == fourPlayerRestartReq {
+				a.requests++
+			} else {
+				a.requests = 0
+			}
+		}
+	}
+
+	if a.requests >= fourPlayerPacketBytes {
+		a.phase = fourPlayerPing
+		a.position = 0
+		a.requests = 0
+		a.connected = 0
+		a.acked = 0x0F
+		return
+	}
+
+	a.position++
+	if a.position < len(a.outbound) {
+		return
+	}
+	a.position = 0
+	for p := range a.players {
+		if a.connected&(1<<p) == 0 {
+			clear(a.inbound[p])
+		}
+		copy(a.outbound[p*size:], a.inbound[p])
+	}
+}
+
+type FourPlayer struct {
+	Players []*GameBoy
+	Adapter *FourPlayerAdapter
+	cycles  uint64
+}
+
+func NewFourPlayer(roms ...[]byte) (*FourPlayer, error) {
+	if len(roms) < 1 || len(roms) > 4 {
+		return nil, fmt.Errorf("four player adapter: %d players, want 1 to 4", len(roms))
+	}
+	f := &FourPlayer{Adapter: NewFourPlayerAdapter()}
+	for i, rom := range roms {
+		gb := NewGameBoy(rom, ModelDMG)
+		f.Adapter.Connect(i, gb.MMU.Serial())
+		f.Players = append(f.Players, gb)
+	}
+	return f, nil
+}
+
+func (f *FourPlayer) Run(cycles int) {
+	end := f.cycles + uint64(cycles)
+	for f.cycles < end {
+		quantum := min(uint64(fourPlayerRunQuantum), end-f.cycles)
+		f.cycles += quantum
+		for _, gb := range f.Players {
+			gb.RunUntil(f.cycles)
+		}
+		f.Adapter.Tick(int(quantum))
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+type fourPlayerRig struct {
+	adapter  *FourPlayerAdapter
+	serials  [4]Serial
+	received [4][]byte
+}
+
+func newFourPlayerRig() *fourPlayerRig {
+	r := &fourPlayerRig{adapter: NewFourPlayerAdapter()}
+	for p := range r.serials {
+		r.adapter.Connect(p, &r.serials[p])
+	}
+	return r
+}
+
+func (r *fourPlayerRig) transfer(out func(p int) uint8) {
+	for p := range r.serials {
+		r.serials[p].Write(0xFF01, out(p))
+		r.serials[p].Write(0xFF02, 0x80)
+	}
+	r.adapter.transfer()
+	for p := range r.serials {
+		if r.serials[p].Read(0xFF02)&0x80 != 0 {
+			continue
+		}
+		r.received[p] = append(r.received[p], r.serials[p].Read(0xFF01))
+	}
+}
+
+func (r *fourPlayerRig) pingPacket(rate, size uint8, start bool) {
+	for pos := range fourPlayerPacketBytes {
+		r.transfer(func(p int) uint8 {
+			switch {
+			case p == 0 && start:
+				return fourPlayerStartReq
+			case pos < 2:
+				return fourPlayerAck
+			case p == 0 && pos == 2:
+				return rate
+			case p == 0 && pos == 3:
+				return size
+			}
+			return 0
+		})
+	}
+}
+
+func TestFourPlayerAdapterHandshake(t *testing.T) {
+	r := newFourPlayerRig()
+
+	r.pingPacket(0x00, 4, false)
+	r.pingPacket(0x00, 4, false)
+	if r.adapter.connected != 0x0F || r.adapter.rate != 0x00 || r.adapter.size != 4 {
+		t.Fatalf("after ping: connected=%02X rate=%02X size=%02X", r.adapter.connected, r.adapter.rate, r.adapter.size)
+	}
+	want := []byte{fourPlayerPingHeader, 0xF3, 0xF3, 0xF3}
+	if got := r.received[2][4:8]; !bytes.Equal(got, want) {
+		t.Fatalf("player 3 ping bytes = % X, want % X", got, want)
+	}
+
+	r.pingPacket(0x00, 4, true)
+	if r.adapter.phase != fourPlayerStart {
+		t.Fatalf("phase = %d after start request, want start", r.adapter.phase)
+	}
+	if r.adapter.connected != 0x0F || r.adapter.size != 4 {
+		t.Fatalf("start request changed config: connected=%02X size=%02X", r.adapter.connected, r.adapter.size)
+	}
+
+	for p := range r.received {
+		r.received[p] = nil
+	}
+	for range fourPlayerPacketBytes {
+		r.transfer(func(int) uint8 { return fourPlayerStartReq })
+	}
+	for p, got := range r.received {
+		if !bytes.Equal(got, bytes.Repeat([]byte{fourPlayerStartAck}, 4)) {
+			t.Fatalf("player %d start bytes = % X", p+1, got)
+		}
+	}
+	if r.adapter.phase != fourPlayerTransmit {
+		t.Fatalf("phase = %d after start, want transmit", r.adapter.phase)
+	}
+
+	for round := range 2 {
+		for p := range r.received {
+			r.received[p] = nil
+		}
+		for pos := range 16 {
+			r.transfer(func(p int) uint8 {
+				if pos < 4 {
+					return uint8(p<<4 | pos)
+				}
+				return 0
+			})
+		}
+		if round == 0 {
+			continue
+		}
+		want := []byte{
+			0x00, 0x01, 0x02, 0x03, 0x10, 0x11, 0x12, 0x13,
+			0x20, 0x21, 0x22, 0x23, 0x30, 0x31, 0x32, 0x33,
+		}
+		for p, got := range r.received {
+			if !bytes.Equal(got, want) {
+				t.Fatalf("player %d received % X, want % X", p+1, got, want)
+			}
+		}
+	}
+}
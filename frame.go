@@ -0,0 +1,8 @@
+package main
+
+const (
+	ScreenWidth  = 160
+	ScreenHeight = 144
+)
+
+type Frame [ScreenWidth * ScreenHeight]uint8
@@ -0,0 +1,47 @@
+package main
+
+const cyclesPerFrame = 70224
+
+type GameBoy struct {
+	CPU   *CPU
+	MMU   *MMU
+	frame Frame
+}
+
+func NewGameBoy(rom []byte, model Model) *GameBoy {
+	mmu := NewMMU(model)
+	mmu.LoadCartridge(rom)
+	cpu := NewCPU(mmu)
+	cpu.PC = 0x0100
+	if model == ModelCGB {
+		cpu.A = 0x11
+		cpu.F = 0x80
+	}
+	gb := &GameBoy{CPU: cpu, MMU: mmu}
+	gb.SetCompatPalette("auto")
+	return gb
+}
+
+func (g *GameBoy) Step() int {
+	cycles := g.CPU.Step()
+	if stall := g.MMU.TakeStall(); stall > 0 {
+		g.MMU.Tick(stall)
+		cycles += stall
+	}
+	return cycles
+}
+
+func (g *GameBoy) Cycles() uint64 {
+	return g.MMU.Scheduler().Now()
+}
+
+func (g *GameBoy) RunUntil(cycle uint64) {
+	for g.Cycles() < cycle {
+		g.Step()
+	}
+	g.MMU.Sync()
+}
+
+func (g *GameBoy) RunFrame() {
+	g.RunUntil(g.Cycles() + cyclesPerFrame)
+}
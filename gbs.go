@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	gbsHeaderSize  = 0x70
+	gbsReturnAddr  = 0xF000
+	gbsCallTimeout = cpuClock
+)
+
+var gbsTimerFrequencies = [4]int{4096, 262144, 65536, 16384}
+
+type GBSHeader struct {
+	Version      uint8
+	Songs        uint8
+	FirstSong    uint8
+	LoadAddr     uint16
+	InitAddr     uint16
+	PlayAddr     uint16
+	SP           uint16
+	TimerModulo  uint8
+	TimerControl uint8
+	Title        string
+	Author       string
+	Copyright    string
+}
+
+type GBS struct {
+	Header GBSHeader
+	rom    []byte
+}
+
+func ParseGBS(data []byte) (*GBS, error) {
+	if len(data) < gbsHeaderSize || string(data[:3]) != "GBS" {
+		return nil, errors.New("gbs: missing GBS header")
+	}
+	h := GBSHeader{
+		Version:      data[3],
+		Songs:        data[4],
+		FirstSong:    data[5],
+		LoadAddr:     binary.LittleEndian.Uint16(data[6:]),
+		InitAddr:     binary.LittleEndian.Uint16(data[8:]),
+		PlayAddr:     binary.LittleEndian.Uint16(data[10:]),
+		SP:           binary.LittleEndian.Uint16(data[12:]),
+		TimerModulo:  data[14],
+		TimerControl: data[15],
+		Title:        gbsString(data[0x10:0x30]),
+		Author:       gbsString(data[0x30:0x50]),
+		Copyright:    gbsString(data[0x50:0x70]),
+	}
+	if h.Version != 1 {
+		return nil, fmt.Errorf("gbs: unsupported version %d", h.Version)
+	}
+	if h.LoadAddr < 0x400 || h.LoadAddr >= 0x8000 {
+		return nil, fmt.Errorf("gbs: load address 0x%04X outside ROM", h.LoadAddr)
+	}
+
+	size := int(h.LoadAddr) + len(data) - gbsHeaderSize
+	rom := make([]byte, (size+0x3FFF)&^0x3FFF)
+	copy(rom[h.LoadAddr:], data[gbsHeaderSize:])
+	for vector := uint16(0); vector < 0x40; vector += 8 {
+		target := h.LoadAddr + vector
+		copy(rom[vector:], []byte{0xC3, uint8(target), uint8(target >> 8)})
+	}
+	return &GBS{Header: h, rom: rom}, nil
+}
+
+func (g *GBS) DefaultTrack() int {
+	return max(int(g.Header.FirstSong), 1) - 1
+}
+
+func gbsString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
+
+type gbsMemory struct {
+	*MMU
+	rom  []byte
+	bank int
+}
+
+func (m *gbsMemory) Read(a uint16) uint8 {
+	switch {
+	case a < 0x4000:
+		return m.rom[a]
+	case a < 0x8000:
+		offset := m.bank*0x4000 + int(a-0x4000)
+		if offset >= len(m.rom) {
+			return 0xFF
+		}
+		return m.rom[offset]
+	}
+	return m.MMU.Read(a)
+}
+
+func (m *gbsMemory) Write(a uint16, v uint8) {
+	switch {
+	case a >= 0x2000 && a < 0x4000:
+		m.bank = max(int(v), 1)
+	case a < 0x8000:
+	default:
+		m.MMU.Write(a, v)
+	}
+}
+
+type GBSPlayer struct {
+	GBS        *GBS
+	MMU        *MMU
+	cpu        *CPU
+	sampleRate int
+	vgm        *VGMWriter
+	playPeriod int
+	untilPlay  int
+}
+
+func NewGBSPlayer(g *GBS, sampleRate int) *GBSPlayer {
+	return &GBSPlayer{GBS: g, sampleRate: sampleRate}
+}
+
+func (p *GBSPlayer) LogVGM(v *VGMWriter) {
+	p.vgm = v
+	if p.MMU != nil {
+		p.MMU.APU().LogVGM(v)
+	}
+}
+
+func (p *GBSPlayer) Start(track int) error {
+	h := p.GBS.Header
+	if track < 0 || track >= int(h.Songs) {
+		return fmt.Errorf("gbs: track %d out of range, file has %d", track+1, h.Songs)
+	}
+
+	p.MMU = NewMMU(ModelDMG)
+	p.MMU.APU().SetSampleRate(p.sampleRate)
+	p.MMU.APU().LogVGM(p.vgm)
+	p.MMU.Write(0xFF06, h.TimerModulo)
+	p.MMU.Write(0xFF07, h.TimerControl)
+
+	p.cpu = NewCPU(&gbsMemory{MMU: p.MMU, rom: p.GBS.rom, bank: 1})
+	p.cpu.SP = h.SP
+	p.cpu.A = uint8(track)
+
+	p.call(h.InitAddr)
+	p.playPeriod = p.period()
+	p.untilPlay = p.playPeriod
+	return nil
+}
+
+func (p *GBSPlayer) period() int {
+	tac := p.MMU.Read(0xFF07)
+	if tac&0x04 == 0 {
+		return cyclesPerFrame
+	}
+	tma := int(p.MMU.Read(0xFF06))
+	period := cpuClock / gbsTimerFrequencies[tac&0x03] * (256 - tma)
+	if p.GBS.Header.TimerControl&0x80 != 0 {
+		period /= 2
+	}
+	return period
+}
+
+func (p *GBSPlayer) call(addr uint16) int {
+	p.cpu.cycles = 0
+	p.cpu.push(gbsReturnAddr)
+	p.cpu.PC = addr
+	cycles := p.cpu.cycles
+	for p.cpu.PC != gbsReturnAddr && cycles < gbsCallTimeout {
+		cycles += p.cpu.Step()
+	}
+	return cycles
+}
+
+func (p *GBSPlayer) Run(cycles int) {
+	for cycles > 0 {
+		n := min(cycles, p.untilPlay)
+		p.MMU.Tick(n)
+		cycles -= n
+		p.untilPlay -= n
+		if p.untilPlay > 0 {
+			continue
+		}
+		used := p.call(p.GBS.Header.PlayAddr)
+		cycles -= used
+		p.untilPlay = max(p.playPeriod-used, 1)
+	}
+	p.MMU.Sync()
+}
+
+func (p *GBSPlayer) RenderWAV(w io.WriteSeeker, track, frames int) (err error) {
+	if err := p.Start(track); err != nil {
+		return err
+	}
+	wav, err := NewWAVWriter(w, p.sampleRate, 2)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := wav.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	for range frames {
+		p.Run(cyclesPerFrame)
+		if err := wav.Write(p.MMU.APU().Samples()); err != nil {
+			return err
+		}
+	}
+	return p.MMU.APU().StopVGM()
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func testGBS(code []byte) []byte {
+	data := make([]byte, gbsHeaderSize)
+	copy(data, "GBS")
+	data[3] = 1
+	data[4] = 3
+	data[5] = 2
+	binary.LittleEndian.PutUint16(data[6:], 0x400)
+	binary.LittleEndian.PutUint16(data[8:], 0x400)
+	binary.LittleEndian.PutUint16(data[10:], 0x410)
+	binary.LittleEndian.PutUint16(data[12:], 0xDFFF)
+	return append(data, code...)
+}
+
+func TestGBSRestartVectors(t *testing.T) {
+	code := make([]byte, 0x20)
+	copy(code[0x00:], []byte{0xCF, 0xC9})
+	copy(code[0x08:], []byte{0x3E, 0x77, 0xEA, 0x00, 0xC0, 0xC9})
+	copy(code[0x10:], []byte{0xC9})
+	g, err := ParseGBS(testGBS(code))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := g.DefaultTrack(); got != 1 {
+		t.Errorf("DefaultTrack() = %d, want 1 for first song 2", got)
+	}
+
+	p := NewGBSPlayer(g, 0)
+	if err := p.Start(g.DefaultTrack()); err != nil {
+		t.Fatal(err)
+	}
+	if got := p.MMU.Read(0xC000); got != 0x77 {
+		t.Errorf("RST $08 handler did not run: C000 = %02X", got)
+	}
+	if p.cpu.PC != gbsReturnAddr {
+		t.Errorf("INIT returned to %04X, want %04X", p.cpu.PC, gbsReturnAddr)
+	}
+}
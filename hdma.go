@@ -0,0 +1,76 @@
+package main
+
+const hdmaBlockCycles = 32
+
+type hdma struct {
+	src    uint16
+	dst    uint16
+	status uint8
+	active bool
+}
+
+func (m *MMU) readHDMA(a uint16) uint8 {
+	if a == 0xFF55 {
+		return m.hdma.status
+	}
+	return 0xFF
+}
+
+func (m *MMU) writeHDMA(a uint16, v uint8) {
+	h := &m.hdma
+	switch a {
+	case 0xFF51:
+		h.src = h.src&0x00FF | uint16(v)<<8
+	case 0xFF52:
+		h.src = h.src&0xFF00 | uint16(v&0xF0)
+	case 0xFF53:
+		h.dst = h.dst&0x00FF | uint16(v&0x1F)<<8
+	case 0xFF54:
+		h.dst = h.dst&0xFF00 | uint16(v&0xF0)
+	case 0xFF55:
+		if h.active && v&0x80 == 0 {
+			h.active = false
+			h.status |= 0x80
+			return
+		}
+		h.status = v & 0x7F
+		if v&0x80 != 0 {
+			h.active = true
+			return
+		}
+		for h.status != 0xFF {
+			m.copyHDMABlock()
+		}
+	}
+}
+
+func (m *MMU) copyHDMABlock() {
+	h := &m.hdma
+	for i := range uint16(0x10) {
+		m.vram[m.vbk][(h.dst+i)&0x1FFF] = m.Read(h.src + i)
+	}
+	h.src += 0x10
+	h.dst = (h.dst + 0x10) & 0x1FF0
+	h.status--
+	if h.status == 0xFF {
+		h.active = false
+	}
+
+	if m.doubleSpeed {
+		m.stall += 2 * hdmaBlockCycles
+	} else {
+		m.stall += hdmaBlockCycles
+	}
+}
+
+func (m *MMU) HBlank() {
+	if m.hdma.active {
+		m.copyHDMABlock()
+	}
+}
+
+func (m *MMU) TakeStall() int {
+	stall := m.stall
+	m.stall = 0
+	return stall
+}
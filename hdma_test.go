@@ -0,0 +1,80 @@
+package main
+
+import "testing"
+
+func newCGBMMU() *MMU {
+	m := NewMMU(ModelCGB)
+	rom := make([]byte, 0x8000)
+	rom[0x143] = 0x80
+	m.LoadCartridge(rom)
+	return m
+}
+
+func TestGeneralPurposeDMA(t *testing.T) {
+	m := newCGBMMU()
+	if got := m.Read(0xFF55); got != 0xFF {
+		t.Errorf("HDMA5 at power-on = %02X, want FF", got)
+	}
+	for i := range uint16(0x20) {
+		m.Write(0xC000+i, uint8(i)+1)
+	}
+	m.Write(0xFF51, 0xC0)
+	m.Write(0xFF52, 0x0F)
+	m.Write(0xFF53, 0xE1)
+	m.Write(0xFF54, 0x2F)
+	m.Write(0xFF55, 0x01)
+
+	for i := range 0x20 {
+		if got := m.vram[0][0x0120+i]; got != uint8(i)+1 {
+			t.Fatalf("VRAM %04X = %02X, want %02X", 0x8120+i, got, i+1)
+		}
+	}
+	if got := m.Read(0xFF55); got != 0xFF {
+		t.Errorf("HDMA5 after transfer = %02X, want FF", got)
+	}
+	if got := m.TakeStall(); got != 2*hdmaBlockCycles {
+		t.Errorf("stall = %d, want %d", got, 2*hdmaBlockCycles)
+	}
+	if got := m.TakeStall(); got != 0 {
+		t.Errorf("second TakeStall = %d, want 0", got)
+	}
+}
+
+func TestHBlankDMA(t *testing.T) {
+	m := newCGBMMU()
+	for i := range uint16(0x30) {
+		m.Write(0xC000+i, 0xA0+uint8(i))
+	}
+	m.Write(0xFF4F, 1)
+	m.Write(0xFF51, 0xC0)
+	m.Write(0xFF52, 0x00)
+	m.Write(0xFF53, 0x00)
+	m.Write(0xFF54, 0x00)
+	m.Write(0xFF55, 0x82)
+	if got := m.Read(0xFF55); got != 0x02 {
+		t.Errorf("HDMA5 after start = %02X, want 02", got)
+	}
+	if m.vram[1][0] != 0 || m.TakeStall() != 0 {
+		t.Error("HBlank DMA copied before the first HBlank")
+	}
+
+	m.HBlank()
+	if got := m.Read(0xFF55); got != 0x01 {
+		t.Errorf("HDMA5 after one block = %02X, want 01", got)
+	}
+	if m.vram[1][0x0F] != 0xAF || m.vram[1][0x10] != 0 {
+		t.Errorf("first block copied %02X %02X, want AF 00", m.vram[1][0x0F], m.vram[1][0x10])
+	}
+	if got := m.TakeStall(); got != hdmaBlockCycles {
+		t.Errorf("stall = %d, want %d", got, hdmaBlockCycles)
+	}
+
+	m.Write(0xFF55, 0x00)
+	if got := m.Read(0xFF55); got != 0x81 {
+		t.Errorf("HDMA5 after cancel = %02X, want 81", got)
+	}
+	m.HBlank()
+	if m.vram[1][0x10] != 0 {
+		t.Error("cancelled transfer kept copying")
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+type Button uint8
+
+const (
+	ButtonRight Button = 1 << iota
+	ButtonLeft
+	ButtonUp
+	ButtonDown
+	ButtonA
+	ButtonB
+	ButtonSelect
+	ButtonStart
+)
+
+type Joypad struct {
+	pressed Button
+	selects uint8
+	irq     bool
+}
+
+func (j *Joypad) Press(b Button) {
+	if j.pressed&b != b {
+		j.irq = true
+	}
+	j.pressed |= b
+}
+
+func (j *Joypad) Release(b Button) {
+	j.pressed &^= b
+}
+
+func (j *Joypad) Read() uint8 {
+	v := uint8(0x0F)
+	if j.selects&0x10 == 0 {
+		v &^= uint8(j.pressed) & 0x0F
+	}
+	if j.selects&0x20 == 0 {
+		v &^= uint8(j.pressed>>4) & 0x0F
+	}
+	return 0xC0 | j.selects | v
+}
+
+func (j *Joypad) Write(v uint8) {
+	j.selects = v & 0x30
+}
+
+func (m *MMU) Joypad() *Joypad {
+	return &m.joypad
+}
+
+func (m *MMU) readP1() uint8 {
+	if m.sgb != nil && m.joypad.selects == 0x30 && m.sgb.players > 1 {
+		return 0xF0 | (0x0F - m.sgb.player)
+	}
+	if m.sgb != nil && m.sgb.player != 0 {
+		return 0xC0 | m.joypad.selects | 0x0F
+	}
+	return m.joypad.Read()
+}
+
+func (m *MMU) writeP1(v uint8) {
+	m.joypad.Write(v)
+	if m.sgb != nil {
+		m.sgb.writeP1(v & 0x30)
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+const (
+	linkSync uint8 = iota + 1
+	linkData
+	linkReply
+)
+
+const (
+	linkMessageSize  = 10
+	linkSyncInterval = 1024
+	linkMaxSkew      = 8192
+)
+
+type linkMessage struct {
+	kind uint8
+	time uint64
+	data uint8
+}
+
+type NetLink struct {
+	conn     net.Conn
+	serial   *Serial
+	incoming chan linkMessage
+	pending  []linkMessage
+	now      uint64
+	peerTime uint64
+	lastSync uint64
+	closed   bool
+}
+
+func NewNetLink(conn net.Conn, serial *Serial) *NetLink {
+	l := &NetLink{
+		conn:     conn,
+		serial:   serial,
+		incoming: make(chan linkMessage, 64),
+	}
+	go l.readLoop()
+	serial.Connect(l)
+	return l
+}
+
+func ListenLink(addr string) (net.Conn, error) {
+	network, address, err := splitLinkAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	ln, err := net.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+	defer ln.Close()
+	return ln.Accept()
+}
+
+func DialLink(addr string) (net.Conn, error) {
+	network, address, err := splitLinkAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	return net.Dial(network, address)
+}
+
+func splitLinkAddr(addr string) (string, string, error) {
+	network, address, ok := strings.Cut(addr, ":")
+	if !ok {
+		return "", "", fmt.Errorf("link address %q: want tcp:host:port or unix:path", addr)
+	}
+	switch network {
+	case "tcp", "tcp4", "tcp6", "unix":
+		return network, address, nil
+	}
+	return "", "", fmt.Errorf("link address %q: unsupported network %q", addr, network)
+}
+
+func (l *NetLink) readLoop() {
+	defer close(l.incoming)
+	var buf [linkMessageSize]byte
+	for {
+		if _, err := io.ReadFull(l.conn, buf[:]); err != nil {
+			return
+		}
+		l.incoming <- linkMessage{
+			kind: buf[0],
+			time: binary.LittleEndian.Uint64(buf[1:9]),
+			data: buf[9],
+		}
+	}
+}
+
+func (l *NetLink) send(kind uint8, data uint8) {
+	if l.closed {
+		return
+	}
+	var buf [linkMessageSize]byte
+	buf[0] = kind
+	binary.LittleEndian.PutUint64(buf[1:9], l.now)
+	buf[9] = data
+	if _, err := l.conn.Write(buf[:]); err != nil {
+		l.Close()
+	}
+	l.lastSync = l.now
+}
+
+func (l *NetLink) receive() (linkMessage, bool) {
+	msg, ok := <-l.incoming
+	if !ok {
+		l.Close()
+		return linkMessage{}, false
+	}
+	if msg.time > l.peerTime {
+		l.peerTime = msg.time
+	}
+	return msg, true
+}
+
+func (l *NetLink) poll() bool {
+	if l.closed {
+		return false
+	}
+	select {
+	case msg, ok := <-l.incoming:
+		if !ok {
+			l.Close()
+			return false
+		}
+		if msg.time > l.peerTime {
+			l.peerTime = msg.time
+		}
+		l.handle(msg)
+		return true
+	default:
+		return false
+	}
+}
+
+func (l *NetLink) handle(msg linkMessage) {
+	if msg.kind != linkData {
+		return
+	}
+	if msg.time > l.now {
+		l.pending = append(l.pending, msg)
+		return
+	}
+	l.send(linkReply, l.serial.Receive(msg.data))
+}
+
+func (l *NetLink) Tick(cycles int) {
+	l.now += uint64(cycles)
+
+	for len(l.pending) > 0 && l.pending[0].time <= l.now {
+		msg := l.pending[0]
+		l.pending = l.pending[1:]
+		l.send(linkReply, l.serial.Receive(msg.data))
+	}
+
+	for l.poll() {
+	}
+
+	if l.now-l.lastSync >= linkSyncInterval {
+		l.send(linkSync, 0)
+	}
+
+	for !l.closed && len(l.pending) == 0 && l.now > l.peerTime+linkMaxSkew {
+		if l.lastSync != l.now {
+			l.send(linkSync, 0)
+		}
+		msg, ok := l.receive()
+		if !ok {
+			return
+		}
+		l.handle(msg)
+	}
+}
+
+func (l *NetLink) Exchange(out uint8) uint8 {
+	l.send(linkData, out)
+	for !l.closed {
+		msg, ok := l.receive()
+		if !ok {
+			break
+		}
+		switch msg.kind {
+		case linkReply:
+			return msg.data
+		case linkData:
+			l.send(linkReply, l.serial.Receive(msg.data))
+		}
+	}
+	return 0xFF
+}
+
+func (l *NetLink) Close() error {
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+	return l.conn.Close()
+}
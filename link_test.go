@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+const linkTestCycles = 40000
+
+type linkScript struct {
+	at    uint64
+	sb    uint8
+	sc    uint8
+	sleep time.Duration
+}
+
+type linkEnd struct {
+	mmu     *MMU
+	link    *NetLink
+	maxSkew uint64
+}
+
+func dialLinkPair(t *testing.T, addr string) (*linkEnd, *linkEnd) {
+	t.Helper()
+	accepted := make(chan net.Conn, 1)
+	errs := make(chan error, 1)
+	go func() {
+		conn, err := ListenLink(addr)
+		if err != nil {
+			errs <- err
+			return
+		}
+		accepted <- conn
+	}()
+
+	var dialed net.Conn
+	var err error
+	for range 100 {
+		if dialed, err = DialLink(addr); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	var listened net.Conn
+	select {
+	case listened = <-accepted:
+	case err := <-errs:
+		t.Fatal(err)
+	}
+
+	a, b := &linkEnd{mmu: NewMMU(ModelDMG)}, &linkEnd{mmu: NewMMU(ModelDMG)}
+	a.link = NewNetLink(listened, a.mmu.Serial())
+	b.link = NewNetLink(dialed, b.mmu.Serial())
+	t.Cleanup(func() {
+		a.link.Close()
+		b.link.Close()
+	})
+	return a, b
+}
+
+func (e *linkEnd) run(script []linkScript, wg *sync.WaitGroup) {
+	defer wg.Done()
+	for now := uint64(0); now < linkTestCycles; now += 4 {
+		for _, s := range script {
+			if s.at != now {
+				continue
+			}
+			time.Sleep(s.sleep)
+			e.mmu.Write(0xFF01, s.sb)
+			e.mmu.Write(0xFF02, s.sc)
+		}
+		e.mmu.Tick(4)
+		if e.link.now > e.link.peerTime {
+			e.maxSkew = max(e.maxSkew, e.link.now-e.link.peerTime)
+		}
+	}
+}
+
+func runLinkPair(a, b *linkEnd, master, slave []linkScript) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go a.run(master, &wg)
+	go b.run(slave, &wg)
+	wg.Wait()
+}
+
+func linkAddrs(t *testing.T) map[string]string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+	return map[string]string{
+		"tcp":  fmt.Sprintf("tcp:127.0.0.1:%d", port),
+		"unix": "unix:" + filepath.Join(t.TempDir(), "link.sock"),
+	}
+}
+
+func TestNetLinkExchange(t *testing.T) {
+	for name, addr := range linkAddrs(t) {
+		t.Run(name, func(t *testing.T) {
+			master, slave := dialLinkPair(t, addr)
+			runLinkPair(master, slave,
+				[]linkScript{{at: 1000, sb: 0x42, sc: 0x81}},
+				[]linkScript{{at: 0, sb: 0x99, sc: 0x80, sleep: 50 * time.Millisecond}},
+			)
+
+			if got := master.mmu.Read(0xFF01); got != 0x99 {
+				t.Errorf("master SB = %02X, want 99", got)
+			}
+			if got := slave.mmu.Read(0xFF01); got != 0x42 {
+				t.Errorf("slave SB = %02X, want 42", got)
+			}
+			if slave.mmu.Read(0xFF0F)&0x08 == 0 {
+				t.Error("slave did not raise the serial interrupt")
+			}
+			for _, e := range []*linkEnd{master, slave} {
+				if e.maxSkew > linkMaxSkew {
+					t.Errorf("clock ran %d cycles ahead of its peer, bound is %d", e.maxSkew, linkMaxSkew)
+				}
+			}
+		})
+	}
+}
+
+func TestNetLinkLateSlave(t *testing.T) {
+	master, slave := dialLinkPair(t, linkAddrs(t)["tcp"])
+	done := uint64(1000 + serialTransferCycles)
+	runLinkPair(master, slave,
+		[]linkScript{
+			{at: 1000, sb: 0x42, sc: 0x81},
+			{at: 20000, sb: 0x43, sc: 0x81},
+		},
+		[]linkScript{
+			{at: done - 96, sb: 0x55, sc: 0x80, sleep: 50 * time.Millisecond},
+			{at: done + 4000, sb: 0x66, sc: 0x80},
+		},
+	)
+
+	if got := master.mmu.Read(0xFF01); got != 0x66 {
+		t.Errorf("master SB = %02X after second transfer, want 66", got)
+	}
+	if got := slave.mmu.Read(0xFF01); got != 0x43 {
+		t.Errorf("slave SB = %02X, want 43", got)
+	}
+
+	master, slave = dialLinkPair(t, linkAddrs(t)["tcp"])
+	runLinkPair(master, slave,
+		[]linkScript{{at: 1000, sb: 0x42, sc: 0x81}},
+		[]linkScript{{at: done + linkMaxSkew + 1000, sb: 0x55, sc: 0x80}},
+	)
+	if got := master.mmu.Read(0xFF01); got != 0xFF {
+		t.Errorf("master SB = %02X with no slave ready, want FF", got)
+	}
+	if got := slave.mmu.Read(0xFF01); got != 0x55 || slave.mmu.Read(0xFF02)&0x80 == 0 {
+		t.Errorf("slave armed past the skew window was disturbed: SB=%02X SC=%02X", got, slave.mmu.Read(0xFF02))
+	}
+}
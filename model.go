@@ -0,0 +1,23 @@
+package main
+
+import "fmt"
+
+type Model int
+
+const (
+	ModelDMG Model = iota
+	ModelCGB
+	ModelSGB
+)
+
+func ParseModel(name string) (Model, error) {
+	switch name {
+	case "dmg":
+		return ModelDMG, nil
+	case "cgb":
+		return ModelCGB, nil
+	case "sgb":
+		return ModelSGB, nil
+	}
+	return 0, fmt.Errorf("unknown hardware model %q, want dmg, cgb or sgb", name)
+}
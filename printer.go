@@ -0,0 +1,250 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"path/filepath"
+)
+
+const (
+	printerInit  = 0x01
+	printerPrint = 0x02
+	printerData  = 0x04
+)
+
+const (
+	printerStatusChecksum    = 0x01
+	printerStatusPrinting    = 0x02
+	printerStatusFull        = 0x04
+	printerStatusUnprocessed = 0x08
+)
+
+const (
+	printerWidth        = 160
+	printerBufferSize   = 0x2280
+	printerMarginPixels = 8
+)
+
+const (
+	printerMagic1 = iota
+	printerMagic2
+	printerCommand
+	printerCompression
+	printerLengthLow
+	printerLengthHigh
+	printerPayload
+	printerChecksumLow
+	printerChecksumHigh
+	printerAck
+	printerReply
+)
+
+type Printer struct {
+	state      int
+	command    uint8
+	compressed bool
+	length     int
+	payload    []byte
+	checksum   uint16
+	sum        uint16
+	status     uint8
+	buffer     []byte
+	dir        string
+	prints     []image.Image
+	feeding    bool
+	err        error
+}
+
+func NewPrinter(dir string) *Printer {
+	return &Printer{dir: dir}
+}
+
+func (p *Printer) Prints() []image.Image {
+	return p.prints
+}
+
+func (p *Printer) Err() error {
+	return p.err
+}
+
+func (p *Printer) Exchange(out uint8) uint8 {
+	switch p.state {
+	case printerMagic1:
+		if out == 0x88 {
+			p.state = printerMagic2
+		}
+	case printerMagic2:
+		if out == 0x33 {
+			p.state = printerCommand
+		} else {
+			p.state = printerMagic1
+		}
+	case printerCommand:
+		p.command = out
+		p.sum = uint16(out)
+		p.state = printerCompression
+	case printerCompression:
+		p.compressed = out&0x01 != 0
+		p.sum += uint16(out)
+		p.state = printerLengthLow
+	case printerLengthLow:
+		p.length = int(out)
+		p.sum += uint16(out)
+		p.state = printerLengthHigh
+	case printerLengthHigh:
+		p.length |= int(out) << 8
+		p.sum += uint16(out)
+		p.payload = p.payload[:0]
+		if p.length > 0 {
+			p.state = printerPayload
+		} else {
+			p.state = printerChecksumLow
+		}
+	case printerPayload:
+		p.payload = append(p.payload, out)
+		p.sum += uint16(out)
+		if len(p.payload) == p.length {
+			p.state = printerChecksumLow
+		}
+	case printerChecksumLow:
+		p.checksum = uint16(out)
+		p.state = printerChecksumHigh
+	case printerChecksumHigh:
+		p.checksum |= uint16(out) << 8
+		p.state = printerAck
+	case printerAck:
+		p.state = printerReply
+		return 0x81
+	case printerReply:
+		p.state = printerMagic1
+		p.execute()
+		status := p.status
+		p.status &^= printerStatusPrinting
+		return status
+	}
+	return 0x00
+}
+
+func (p *Printer) execute() {
+	if p.checksum != p.sum {
+		p.status |= printerStatusChecksum
+		return
+	}
+	p.status &^= printerStatusChecksum
+
+	switch p.command {
+	case printerInit:
+		p.buffer = p.buffer[:0]
+		p.status = 0
+	case printerData:
+		data := p.payload
+		if p.compressed {
+			data = decompressPrinterData(data)
+		}
+		p.buffer = append(p.buffer, data...)
+		if len(p.buffer) > printerBufferSize {
+			p.buffer = p.buffer[:printerBufferSize]
+		}
+		if len(p.buffer) == printerBufferSize {
+			p.status |= printerStatusFull
+		}
+		if len(data) > 0 {
+			p.status |= printerStatusUnprocessed
+		}
+	case printerPrint:
+		if len(p.payload) < 4 {
+			return
+		}
+		p.print(p.payload[0], p.payload[1], p.payload[2])
+		p.buffer = p.buffer[:0]
+		p.status &^= printerStatusUnprocessed | printerStatusFull
+		p.status |= printerStatusPrinting
+	}
+}
+
+func decompressPrinterData(data []byte) []byte {
+	var out []byte
+	for i := 0; i < len(data); {
+		ctrl := data[i]
+		i++
+		if ctrl&0x80 != 0 {
+			if i >= len(data) {
+				break
+			}
+			for range int(ctrl&0x7F) + 2 {
+				out = append(out, data[i])
+			}
+			i++
+			continue
+		}
+		n := min(int(ctrl)+1, len(data)-i)
+		out = append(out, data[i:i+n]...)
+		i += n
+	}
+	return out
+}
+
+func (p *Printer) print(sheets, margins, palette uint8) {
+	if sheets == 0 {
+		return
+	}
+	if palette == 0 {
+		palette = 0xE4
+	}
+
+	tileRows := len(p.buffer) / (printerWidth / 8 * 16)
+	top := int(margins>>4) * printerMarginPixels
+	bottom := int(margins&0x0F) * printerMarginPixels
+	sheetHeight := tileRows * 8
+	height := top + int(sheets)*sheetHeight + bottom
+
+	img := image.NewGray(image.Rect(0, 0, printerWidth, height))
+	for i := range img.Pix {
+		img.Pix[i] = 0xFF
+	}
+
+	for sheet := range int(sheets) {
+		y0 := top + sheet*sheetHeight
+		for tile := range tileRows * printerWidth / 8 {
+			tx := tile % (printerWidth / 8)
+			ty := tile / (printerWidth / 8)
+			for row := range 8 {
+				lo := p.buffer[tile*16+row*2]
+				hi := p.buffer[tile*16+row*2+1]
+				for col := range 8 {
+					bit := 7 - col
+					idx := (lo>>bit)&1 | ((hi>>bit)&1)<<1
+					shade := (palette >> (idx * 2)) & 0x03
+					img.SetGray(tx*8+col, y0+ty*8+row, color.Gray{Y: 0xFF - shade*0x55})
+				}
+			}
+		}
+	}
+
+	if n := len(p.prints); n > 0 && p.feeding && top == 0 {
+		img = joinPrints(p.prints[n-1].(*image.Gray), img)
+		p.prints[n-1] = img
+	} else {
+		p.prints = append(p.prints, img)
+	}
+	p.feeding = bottom == 0
+
+	if p.dir == "" {
+		return
+	}
+	if err := p.save(img, len(p.prints)); err != nil && p.err == nil {
+		p.err = err
+	}
+}
+
+func joinPrints(a, b *image.Gray) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, printerWidth, a.Rect.Dy()+b.Rect.Dy()))
+	copy(img.Pix, a.Pix)
+	copy(img.Pix[len(a.Pix):], b.Pix)
+	return img
+}
+
+func (p *Printer) save(img image.Image, n int) error {
+	return SavePNG(filepath.Join(p.dir, fmt.Sprintf("print-%03d.png", n)), img)
+}
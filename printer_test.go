@@ -0,0 +1,93 @@
+package main
+
+import (
+	"image"
+	"path/filepath"
+	"testing"
+)
+
+func sendPrinterPacket(p *Printer, command uint8, compressed bool, payload []byte) (ack, status uint8) {
+	header := []byte{command, 0, uint8(len(payload)), uint8(len(payload) >> 8)}
+	if compressed {
+		header[1] = 1
+	}
+	var sum uint16
+	for _, b := range append(header, payload...) {
+		sum += uint16(b)
+	}
+	packet := append([]byte{0x88, 0x33}, header...)
+	packet = append(packet, payload...)
+	packet = append(packet, uint8(sum), uint8(sum>>8))
+	for _, b := range packet {
+		p.Exchange(b)
+	}
+	return p.Exchange(0), p.Exchange(0)
+}
+
+func printerRow() []byte {
+	data := []byte{0x01, 0xF0, 0x0F, 0x80 | 12, 0xFF}
+	for range 2 {
+		data = append(data, 0x80|0x7F, 0x00)
+	}
+	return append(data, 0x80|44, 0x00)
+}
+
+func TestPrinterPackets(t *testing.T) {
+	p := NewPrinter("")
+	check := func(name string, ack, status, want uint8) {
+		t.Helper()
+		if ack != 0x81 || status != want {
+			t.Errorf("%s: ack=%02X status=%02X, want 81 %02X", name, ack, status, want)
+		}
+	}
+
+	ack, status := sendPrinterPacket(p, printerInit, false, nil)
+	check("INIT", ack, status, 0x00)
+	ack, status = sendPrinterPacket(p, printerData, true, printerRow())
+	check("DATA", ack, status, printerStatusUnprocessed)
+	if len(p.buffer) != printerWidth/8*16 {
+		t.Fatalf("decompressed %d bytes, want %d", len(p.buffer), printerWidth/8*16)
+	}
+	ack, status = sendPrinterPacket(p, printerPrint, false, []byte{1, 0x00, 0xE4, 0x40})
+	check("PRINT", ack, status, printerStatusPrinting)
+
+	if len(p.Prints()) != 1 {
+		t.Fatalf("%d prints, want 1", len(p.Prints()))
+	}
+	img := p.Prints()[0].(*image.Gray)
+	for _, c := range []struct {
+		x, y int
+		want uint8
+	}{{0, 0, 0xAA}, {4, 0, 0x55}, {0, 1, 0x00}, {8, 0, 0xFF}} {
+		if got := img.GrayAt(c.x, c.y).Y; got != c.want {
+			t.Errorf("pixel (%d,%d) = %02X, want %02X", c.x, c.y, got, c.want)
+		}
+	}
+
+	sendPrinterPacket(p, printerData, true, printerRow())
+	sendPrinterPacket(p, printerPrint, false, []byte{1, 0x01, 0xE4, 0x40})
+	if len(p.Prints()) != 1 || p.Prints()[0].Bounds().Dy() != 16+printerMarginPixels {
+		t.Errorf("continuous feed: %d prints, first %v tall, want one print of %d rows",
+			len(p.Prints()), p.Prints()[0].Bounds().Dy(), 16+printerMarginPixels)
+	}
+	sendPrinterPacket(p, printerData, true, printerRow())
+	sendPrinterPacket(p, printerPrint, false, []byte{1, 0x00, 0xE4, 0x40})
+	if len(p.Prints()) != 2 {
+		t.Errorf("print after a bottom margin joined the previous one: %d prints, want 2", len(p.Prints()))
+	}
+
+	packet := []byte{0x88, 0x33, printerInit, 0, 0, 0, 0xFF, 0xFF}
+	for _, b := range packet {
+		p.Exchange(b)
+	}
+	check("bad checksum", p.Exchange(0), p.Exchange(0), printerStatusChecksum)
+}
+
+func TestPrinterSaveError(t *testing.T) {
+	p := NewPrinter(filepath.Join(t.TempDir(), "missing"))
+	sendPrinterPacket(p, printerData, true, printerRow())
+	sendPrinterPacket(p, printerPrint, false, []byte{1, 0x00, 0xE4, 0x40})
+	if p.Err() == nil {
+		t.Error("saving into a missing directory did not set Err")
+	}
+}
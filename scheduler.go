@@ -0,0 +1,71 @@
+package main
+
+import "math"
+
+const frameSequencerPeriod = cpuClock / 512
+
+type eventKind int
+
+const (
+	eventFrameSequencer eventKind = iota
+	eventSerial
+	eventSerialPeer
+	eventKinds
+)
+
+type event struct {
+	at      uint64
+	pending bool
+	fire    func()
+}
+
+type Scheduler struct {
+	now    uint64
+	next   uint64
+	events [eventKinds]event
+}
+
+func newScheduler() *Scheduler {
+	return &Scheduler{next: math.MaxUint64}
+}
+
+func (s *Scheduler) Now() uint64 {
+	return s.now
+}
+
+func (s *Scheduler) Schedule(kind eventKind, delay int, fire func()) {
+	s.events[kind] = event{at: s.now + uint64(max(delay, 0)), pending: true, fire: fire}
+	s.next = min(s.next, s.events[kind].at)
+}
+
+func (s *Scheduler) Cancel(kind eventKind) {
+	s.events[kind].pending = false
+	s.updateNext()
+}
+
+func (s *Scheduler) updateNext() {
+	s.next = math.MaxUint64
+	for _, e := range s.events {
+		if e.pending {
+			s.next = min(s.next, e.at)
+		}
+	}
+}
+
+func (s *Scheduler) Advance(cycles int) {
+	target := s.now + uint64(cycles)
+	for s.next <= target {
+		for kind := range s.events {
+			e := &s.events[kind]
+			if !e.pending || e.at != s.next {
+				continue
+			}
+			s.now = e.at
+			e.pending = false
+			e.fire()
+			break
+		}
+		s.updateNext()
+	}
+	s.now = target
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type DMGPalette [4]color.RGBA
+
+var dmgPalettes = map[string]DMGPalette{
+	"grayscale": rgbPalette(0xFFFFFF, 0xAAAAAA, 0x555555, 0x000000),
+	"green":     rgbPalette(0x9BBC0F, 0x8BAC0F, 0x306230, 0x0F380F),
+}
+
+func rgbPalette(c0, c1, c2, c3 uint32) DMGPalette {
+	var p DMGPalette
+	for i, c := range [4]uint32{c0, c1, c2, c3} {
+		p[i] = color.RGBA{R: uint8(c >> 16), G: uint8(c >> 8), B: uint8(c), A: 0xFF}
+	}
+	return p
+}
+
+func ParseDMGPalette(spec string) (DMGPalette, error) {
+	if p, ok := dmgPalettes[strings.ToLower(spec)]; ok {
+		return p, nil
+	}
+	fields := strings.Split(spec, ",")
+	if len(fields) != 4 {
+		return DMGPalette{}, fmt.Errorf("unknown palette %q, want grayscale, green or four RRGGBB colors", spec)
+	}
+	var colors [4]uint32
+	for i, field := range fields {
+		c, err := strconv.ParseUint(strings.TrimPrefix(strings.TrimSpace(field), "#"), 16, 24)
+		if err != nil {
+			return DMGPalette{}, fmt.Errorf("invalid palette color %q", field)
+		}
+		colors[i] = uint32(c)
+	}
+	return rgbPalette(colors[0], colors[1], colors[2], colors[3]), nil
+}
+
+func (f *Frame) Image(p DMGPalette) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, ScreenWidth, ScreenHeight))
+	for i, shade := range f {
+		img.SetRGBA(i%ScreenWidth, i/ScreenWidth, p[shade&0x03])
+	}
+	return img
+}
+
+func scaleImage(src *image.RGBA, scale int) *image.RGBA {
+	if scale <= 1 {
+		return src
+	}
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx()*scale, b.Dy()*scale))
+	for y := range dst.Rect.Dy() {
+		for x := range dst.Rect.Dx() {
+			dst.SetRGBA(x, y, src.RGBAAt(b.Min.X+x/scale, b.Min.Y+y/scale))
+		}
+	}
+	return dst
+}
+
+func (g *GameBoy) Frame() *Frame {
+	return &g.frame
+}
+
+func (g *GameBoy) Image(p DMGPalette, scale int) *image.RGBA {
+	if sgb := g.MMU.SGB(); sgb != nil {
+		return scaleImage(sgb.Compose(&g.frame), scale)
+	}
+	return scaleImage(g.frame.Image(p), scale)
+}
+
+func (g *GameBoy) Screenshot(path string, p DMGPalette, scale int) error {
+	return SavePNG(path, g.Image(p, scale))
+}
+
+func SavePNG(path string, img image.Image) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
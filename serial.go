@@ -0,0 +1,111 @@
+package main
+
+const (
+	serialTransferCycles     = 4096
+	serialFastTransferCycles = 128
+	serialPeerQuantum        = 64
+)
+
+type SerialPeer interface {
+	Exchange(out uint8) uint8
+}
+
+type serialTicker interface {
+	Tick(cycles int)
+}
+
+type Serial struct {
+	sb   uint8
+	sc   uint8
+	irq  bool
+	cgb  bool
+	peer SerialPeer
+}
+
+func (s *Serial) Connect(p SerialPeer) {
+	s.peer = p
+}
+
+func (s *Serial) Read(a uint16) uint8 {
+	switch a {
+	case 0xFF01:
+		return s.sb
+	case 0xFF02:
+		if s.cgb {
+			return s.sc | 0x7C
+		}
+		return s.sc | 0x7E
+	}
+	return 0xFF
+}
+
+func (s *Serial) Write(a uint16, v uint8) {
+	switch a {
+	case 0xFF01:
+		s.sb = v
+	case 0xFF02:
+		s.sc = v & 0x81
+		if s.cgb {
+			s.sc = v & 0x83
+		}
+	}
+}
+
+func (s *Serial) transferCycles() int {
+	switch {
+	case s.sc&0x81 != 0x81:
+		return 0
+	case s.sc&0x02 != 0:
+		return serialFastTransferCycles
+	}
+	return serialTransferCycles
+}
+
+func (s *Serial) complete() {
+	if s.sc&0x81 != 0x81 {
+		return
+	}
+	in := uint8(0xFF)
+	if s.peer != nil {
+		in = s.peer.Exchange(s.sb)
+	}
+	s.sb = in
+	s.sc &^= 0x80
+	s.irq = true
+}
+
+func (s *Serial) Receive(in uint8) uint8 {
+	if s.sc&0x81 != 0x80 {
+		return 0xFF
+	}
+	out := s.sb
+	s.sb = in
+	s.sc &^= 0x80
+	s.irq = true
+	return out
+}
+
+func (s *Serial) Tick(cycles int) {
+	if t, ok := s.peer.(serialTicker); ok {
+		t.Tick(cycles)
+	}
+}
+
+func (s *Serial) takeIRQ() bool {
+	irq := s.irq
+	s.irq = false
+	return irq
+}
+
+type serialCable struct {
+	other *Serial
+}
+
+func (c serialCable) Exchange(out uint8) uint8 {
+	return c.other.Receive(out)
+}
+
+func ConnectSerials(a, b *Serial) {
+	a.Connect(serialCable{other: b})
+	b.Connect(serialCable{other: a})
+}
@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+func TestConnectSerials(t *testing.T) {
+	master, slave := NewMMU(ModelDMG), NewMMU(ModelDMG)
+	ConnectSerials(master.Serial(), slave.Serial())
+
+	slave.Write(0xFF01, 0x99)
+	slave.Write(0xFF02, 0x80)
+	master.Write(0xFF01, 0x42)
+	master.Write(0xFF02, 0x81)
+	for range serialTransferCycles / 4 {
+		master.Tick(4)
+		slave.Tick(4)
+	}
+
+	if got := master.Read(0xFF01); got != 0x99 {
+		t.Errorf("master SB = %02X, want 99", got)
+	}
+	if got := slave.Read(0xFF01); got != 0x42 {
+		t.Errorf("slave SB = %02X, want 42", got)
+	}
+	for name, m := range map[string]*MMU{"master": master, "slave": slave} {
+		if m.Read(0xFF02)&0x80 != 0 || m.Read(0xFF0F)&0x08 == 0 {
+			t.Errorf("%s SC=%02X IF=%02X, want transfer done with serial interrupt", name, m.Read(0xFF02), m.Read(0xFF0F))
+		}
+	}
+}
+
+func TestSerialSBWriteKeepsTransferTiming(t *testing.T) {
+	m := NewMMU(ModelDMG)
+	m.Write(0xFF01, 0x42)
+	m.Write(0xFF02, 0x81)
+	m.Tick(serialTransferCycles / 2)
+	m.Write(0xFF01, 0x43)
+	m.Tick(serialTransferCycles / 2)
+	if m.Read(0xFF02)&0x80 != 0 {
+		t.Error("writing SB mid-transfer restarted the transfer")
+	}
+}
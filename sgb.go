@@ -0,0 +1,339 @@
+package main
+
+import (
+	"encoding/binary"
+	"image"
+)
+
+const (
+	SGBWidth  = 256
+	SGBHeight = 224
+
+	sgbScreenX    = 48
+	sgbScreenY    = 40
+	sgbCellsX     = ScreenWidth / 8
+	sgbCellsY     = ScreenHeight / 8
+	sgbPacketBits = 128
+	sgbBorderPals = 0x800
+)
+
+const (
+	sgbPAL01   = 0x00
+	sgbPAL23   = 0x01
+	sgbPAL03   = 0x02
+	sgbPAL12   = 0x03
+	sgbATTRBLK = 0x04
+	sgbATTRLIN = 0x05
+	sgbATTRDIV = 0x06
+	sgbATTRCHR = 0x07
+	sgbMLTREQ  = 0x11
+	sgbCHRTRN  = 0x13
+	sgbPCTTRN  = 0x14
+	sgbMASKEN  = 0x17
+)
+
+const (
+	sgbMaskNone = iota
+	sgbMaskFreeze
+	sgbMaskBlack
+	sgbMaskColor0
+)
+
+var sgbDefaultPalette = [4]uint16{0x67BF, 0x265B, 0x10B5, 0x2866}
+
+type SGB struct {
+	mmu *MMU
+
+	lastP1    uint8
+	receiving bool
+	bit       int
+	packet    [16]byte
+	data      []byte
+
+	palettes [4][4]uint16
+	attr     [sgbCellsX * sgbCellsY]uint8
+	mask     uint8
+	frozen   *Frame
+	players  uint8
+	player   uint8
+
+	chr [0x2000]byte
+	pct [0x1000]byte
+}
+
+func newSGB(m *MMU) *SGB {
+	s := &SGB{mmu: m, lastP1: 0x30, players: 1}
+	for i := range s.palettes {
+		s.palettes[i] = sgbDefaultPalette
+	}
+	return s
+}
+
+func sgbSupported(rom []byte) bool {
+	return rom[0x146] == 0x03 && rom[0x14B] == 0x33
+}
+
+func (s *SGB) writeP1(v uint8) {
+	prev := s.lastP1
+	s.lastP1 = v
+	switch v {
+	case 0x00:
+		s.receiving = true
+		s.bit = 0
+		s.packet = [16]byte{}
+		return
+	case 0x30:
+		if !s.receiving && prev&0x20 == 0 && s.players > 1 {
+			s.player = (s.player + 1) % s.players
+		}
+		return
+	}
+	if !s.receiving || prev != 0x30 {
+		return
+	}
+	if s.bit == sgbPacketBits {
+		s.receiving = false
+		if v == 0x20 {
+			s.receivePacket()
+		}
+		return
+	}
+	if v == 0x10 {
+		s.packet[s.bit/8] |= 1 << (s.bit % 8)
+	}
+	s.bit++
+}
+
+func (s *SGB) receivePacket() {
+	if len(s.data) == 0 && s.packet[0]&0x07 == 0 {
+		return
+	}
+	s.data = append(s.data, s.packet[:]...)
+	if len(s.data) < int(s.data[0]&0x07)*len(s.packet) {
+		return
+	}
+	s.command(s.data)
+	s.data = s.data[:0]
+}
+
+func (s *SGB) command(data []byte) {
+	switch data[0] >> 3 {
+	case sgbPAL01:
+		s.setPalettes(0, 1, data)
+	case sgbPAL23:
+		s.setPalettes(2, 3, data)
+	case sgbPAL03:
+		s.setPalettes(0, 3, data)
+	case sgbPAL12:
+		s.setPalettes(1, 2, data)
+	case sgbATTRBLK:
+		s.attrBlock(data)
+	case sgbATTRLIN:
+		s.attrLine(data)
+	case sgbATTRDIV:
+		s.attrDivide(data)
+	case sgbATTRCHR:
+		s.attrChar(data)
+	case sgbMLTREQ:
+		s.players = [4]uint8{1, 2, 1, 4}[data[1]&0x03]
+		s.player = 0
+	case sgbCHRTRN:
+		copy(s.chr[int(data[1]&0x01)*0x1000:], s.mmu.sgbTransferData())
+	case sgbPCTTRN:
+		copy(s.pct[:], s.mmu.sgbTransferData())
+	case sgbMASKEN:
+		s.mask = data[1] & 0x03
+		if s.mask != sgbMaskFreeze {
+			s.frozen = nil
+		}
+	}
+}
+
+func (s *SGB) setPalettes(a, b int, data []byte) {
+	color := func(i int) uint16 {
+		return binary.LittleEndian.Uint16(data[1+i*2:]) & 0x7FFF
+	}
+	for i := range s.palettes {
+		s.palettes[i][0] = color(0)
+	}
+	for i := 1; i < 4; i++ {
+		s.palettes[a][i] = color(i)
+		s.palettes[b][i] = color(i + 3)
+	}
+}
+
+func (s *SGB) setAttr(x, y int, pal uint8) {
+	if x < sgbCellsX && y < sgbCellsY {
+		s.attr[y*sgbCellsX+x] = pal & 0x03
+	}
+}
+
+func (s *SGB) attrBlock(data []byte) {
+	for i := range int(data[1] & 0x1F) {
+		d := data[2+i*6:]
+		if len(d) < 6 {
+			return
+		}
+		ctrl := d[0] & 0x07
+		inside, border, outside := ctrl&0x01 != 0, ctrl&0x02 != 0, ctrl&0x04 != 0
+		pIn, pBorder, pOut := d[1]&0x03, d[1]>>2&0x03, d[1]>>4&0x03
+		switch ctrl {
+		case 0x01:
+			border, pBorder = true, pIn
+		case 0x04:
+			border, pBorder = true, pOut
+		}
+		x1, y1, x2, y2 := int(d[2]&0x1F), int(d[3]&0x1F), int(d[4]&0x1F), int(d[5]&0x1F)
+		for y := range sgbCellsY {
+			for x := range sgbCellsX {
+				switch {
+				case x < x1 || x > x2 || y < y1 || y > y2:
+					if outside {
+						s.setAttr(x, y, pOut)
+					}
+				case x == x1 || x == x2 || y == y1 || y == y2:
+					if border {
+						s.setAttr(x, y, pBorder)
+					}
+				case inside:
+					s.setAttr(x, y, pIn)
+				}
+			}
+		}
+	}
+}
+
+func (s *SGB) attrLine(data []byte) {
+	for _, b := range data[2:min(2+int(data[1]), len(data))] {
+		line, pal := int(b&0x1F), b>>5&0x03
+		for i := range max(sgbCellsX, sgbCellsY) {
+			if b&0x80 != 0 {
+				s.setAttr(i, line, pal)
+			} else {
+				s.setAttr(line, i, pal)
+			}
+		}
+	}
+}
+
+func (s *SGB) attrDivide(data []byte) {
+	d, split := data[1], int(data[2]&0x1F)
+	for y := range sgbCellsY {
+		for x := range sgbCellsX {
+			pos := x
+			if d&0x40 != 0 {
+				pos = y
+			}
+			switch {
+			case pos < split:
+				s.setAttr(x, y, d>>2)
+			case pos == split:
+				s.setAttr(x, y, d>>4)
+			default:
+				s.setAttr(x, y, d)
+			}
+		}
+	}
+}
+
+func (s *SGB) attrChar(data []byte) {
+	x, y := int(data[1]&0x1F), int(data[2]&0x1F)
+	n := int(binary.LittleEndian.Uint16(data[3:]))
+	for i := range n {
+		if 6+i/4 >= len(data) || x >= sgbCellsX || y >= sgbCellsY {
+			return
+		}
+		s.setAttr(x, y, data[6+i/4]>>(6-2*(i%4)))
+		if data[5]&0x01 == 0 {
+			if x++; x == sgbCellsX {
+				x, y = 0, y+1
+			}
+		} else {
+			if y++; y == sgbCellsY {
+				x, y = x+1, 0
+			}
+		}
+	}
+}
+
+func (m *MMU) sgbTransferData() []byte {
+	lcdc := m.io[0x40]
+	base := 0x1800
+	if lcdc&0x08 != 0 {
+		base = 0x1C00
+	}
+	out := make([]byte, 0, 0x1000)
+	for i := range 256 {
+		tile := m.vram[0][base+i/sgbCellsX*32+i%sgbCellsX]
+		addr := int(tile) * 16
+		if lcdc&0x10 == 0 {
+			addr = 0x1000 + int(int8(tile))*16
+		}
+		out = append(out, m.vram[0][addr:addr+16]...)
+	}
+	return out
+}
+
+func (s *SGB) Compose(frame *Frame) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, SGBWidth, SGBHeight))
+	backdrop := RGB555ToRGBA(s.palettes[0][0])
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = backdrop.R, backdrop.G, backdrop.B, backdrop.A
+	}
+
+	if s.mask == sgbMaskFreeze && s.frozen == nil {
+		f := *frame
+		s.frozen = &f
+	}
+	if s.frozen != nil {
+		frame = s.frozen
+	}
+	for y := range ScreenHeight {
+		for x := range ScreenWidth {
+			c := s.palettes[s.attr[y/8*sgbCellsX+x/8]][frame[y*ScreenWidth+x]&0x03]
+			switch s.mask {
+			case sgbMaskBlack:
+				c = 0
+			case sgbMaskColor0:
+				c = s.palettes[0][0]
+			}
+			img.SetRGBA(sgbScreenX+x, sgbScreenY+y, RGB555ToRGBA(c))
+		}
+	}
+
+	for ty := range SGBHeight / 8 {
+		for tx := range SGBWidth / 8 {
+			s.drawBorderTile(img, tx, ty)
+		}
+	}
+	return img
+}
+
+func (s *SGB) drawBorderTile(img *image.RGBA, tx, ty int) {
+	entry := binary.LittleEndian.Uint16(s.pct[(ty*32+tx)*2:])
+	tile := s.chr[int(entry&0xFF)*32:]
+	pals := s.pct[sgbBorderPals+int(entry>>10&0x03)*32:]
+	for py := range 8 {
+		row := py
+		if entry&0x8000 != 0 {
+			row = 7 - py
+		}
+		for px := range 8 {
+			bit := uint(7 - px)
+			if entry&0x4000 != 0 {
+				bit = uint(px)
+			}
+			idx := tile[row*2]>>bit&1 | tile[row*2+1]>>bit&1<<1 |
+				tile[16+row*2]>>bit&1<<2 | tile[16+row*2+1]>>bit&1<<3
+			if idx == 0 {
+				continue
+			}
+			c := binary.LittleEndian.Uint16(pals[int(idx)*2:])
+			img.SetRGBA(tx*8+px, ty*8+py, RGB555ToRGBA(c))
+		}
+	}
+}
+
+func (m *MMU) SGB() *SGB {
+	return m.sgb
+}
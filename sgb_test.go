@@ -0,0 +1,117 @@
+package main
+
+import "testing"
+
+func newSGBMMU() *MMU {
+	m := NewMMU(ModelSGB)
+	rom := make([]byte, 0x8000)
+	rom[0x146], rom[0x14B] = 0x03, 0x33
+	m.LoadCartridge(rom)
+	return m
+}
+
+func sendSGBPacket(m *MMU, packet []byte) {
+	m.Write(0xFF00, 0x00)
+	m.Write(0xFF00, 0x30)
+	for i := range sgbPacketBits {
+		if i/8 < len(packet) && packet[i/8]>>(i%8)&1 != 0 {
+			m.Write(0xFF00, 0x10)
+		} else {
+			m.Write(0xFF00, 0x20)
+		}
+		m.Write(0xFF00, 0x30)
+	}
+	m.Write(0xFF00, 0x20)
+	m.Write(0xFF00, 0x30)
+}
+
+func TestSGBPal01(t *testing.T) {
+	m := newSGBMMU()
+	sendSGBPacket(m, []byte{sgbPAL01<<3 | 1,
+		0x34, 0x12,
+		0x01, 0x00, 0x02, 0x00, 0x03, 0x00,
+		0x11, 0x00, 0x12, 0x00, 0xFF, 0xFF,
+	})
+	s := m.SGB()
+	if want := [4]uint16{0x1234, 0x01, 0x02, 0x03}; s.palettes[0] != want {
+		t.Errorf("palette 0 = %04X, want %04X", s.palettes[0], want)
+	}
+	if want := [4]uint16{0x1234, 0x11, 0x12, 0x7FFF}; s.palettes[1] != want {
+		t.Errorf("palette 1 = %04X, want %04X", s.palettes[1], want)
+	}
+	if want := [4]uint16{0x1234, sgbDefaultPalette[1], sgbDefaultPalette[2], sgbDefaultPalette[3]}; s.palettes[2] != want {
+		t.Errorf("palette 2 = %04X, want %04X", s.palettes[2], want)
+	}
+}
+
+func TestSGBAttrBlock(t *testing.T) {
+	m := newSGBMMU()
+	s := m.SGB()
+	attr := func(x, y int) uint8 { return s.attr[y*sgbCellsX+x] }
+
+	sendSGBPacket(m, []byte{sgbATTRBLK<<3 | 1, 1,
+		0x07, 3<<4 | 2<<2 | 1, 2, 3, 6, 8,
+	})
+	for _, c := range []struct {
+		x, y int
+		want uint8
+	}{{4, 5, 1}, {2, 5, 2}, {6, 8, 2}, {4, 3, 2}, {1, 5, 3}, {0, 0, 3}, {7, 9, 3}} {
+		if got := attr(c.x, c.y); got != c.want {
+			t.Errorf("all rules: cell (%d,%d) = %d, want %d", c.x, c.y, got, c.want)
+		}
+	}
+
+	first := []byte{sgbATTRBLK<<3 | 2, 3,
+		0x01, 0, 10, 10, 12, 12,
+		0x04, 2 << 4, 0, 0, 19, 17,
+		0x02, 0,
+	}
+	sendSGBPacket(m, first)
+	if got := attr(10, 10); got != 3 {
+		t.Fatalf("multi-packet command ran after its first packet: cell (10,10) = %d", got)
+	}
+	sendSGBPacket(m, []byte{15, 0, 17, 2})
+	for _, c := range []struct {
+		x, y int
+		want uint8
+	}{
+		{10, 10, 0}, {11, 11, 0}, {12, 11, 0},
+		{0, 0, 2}, {19, 17, 2}, {0, 9, 2}, {4, 5, 1}, {1, 5, 3},
+		{15, 1, 0}, {17, 2, 0}, {16, 1, 3},
+	} {
+		if got := attr(c.x, c.y); got != c.want {
+			t.Errorf("cell (%d,%d) = %d, want %d", c.x, c.y, got, c.want)
+		}
+	}
+}
+
+func TestSGBMultiplayer(t *testing.T) {
+	m := newSGBMMU()
+	readIDs := func() []uint8 {
+		var ids []uint8
+		for range 5 {
+			ids = append(ids, m.Read(0xFF00))
+			m.Write(0xFF00, 0x10)
+			m.Write(0xFF00, 0x30)
+		}
+		return ids
+	}
+
+	for _, c := range []struct {
+		mode uint8
+		want []uint8
+	}{
+		{0x01, []uint8{0xFF, 0xFE, 0xFF, 0xFE, 0xFF}},
+		{0x03, []uint8{0xFF, 0xFE, 0xFD, 0xFC, 0xFF}},
+		{0x00, []uint8{0xFF, 0xFF, 0xFF, 0xFF, 0xFF}},
+	} {
+		sendSGBPacket(m, []byte{sgbMLTREQ<<3 | 1, c.mode})
+		got := readIDs()
+		for i := range got {
+			if got[i] != c.want[i] {
+				t.Errorf("MLT_REQ %d: P1 reads % X, want % X", c.mode, got, c.want)
+				break
+			}
+		}
+	}
+}
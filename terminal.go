@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"os"
+)
+
+const terminalHoldFrames = 6
+
+var terminalKeys = map[string]Button{
+	"\x1b[A": ButtonUp,
+	"\x1b[B": ButtonDown,
+	"\x1b[C": ButtonRight,
+	"\x1b[D": ButtonLeft,
+	"w":      ButtonUp,
+	"s":      ButtonDown,
+	"d":      ButtonRight,
+	"a":      ButtonLeft,
+	"x":      ButtonA,
+	"z":      ButtonB,
+	"\r":     ButtonStart,
+	"\x7f":   ButtonSelect,
+	" ":      ButtonSelect,
+}
+
+var makeRaw = func(f *os.File) (func() error, error) {
+	return nil, errors.New("raw terminal input is only supported on linux")
+}
+
+type TerminalRenderer struct {
+	out       *bufio.Writer
+	trueColor bool
+	keys      chan byte
+	pending   []byte
+	held      map[Button]int
+	restore   func() error
+	fg, bg    string
+}
+
+func NewTerminalRenderer(out io.Writer, trueColor bool) *TerminalRenderer {
+	t := &TerminalRenderer{out: bufio.NewWriter(out), trueColor: trueColor, held: map[Button]int{}}
+	fmt.Fprint(t.out, "\x1b[?25l\x1b[2J")
+	return t
+}
+
+func (t *TerminalRenderer) StartInput(in *os.File) error {
+	restore, err := makeRaw(in)
+	if err != nil {
+		return err
+	}
+	t.restore = restore
+	t.keys = make(chan byte, 64)
+	go func() {
+		buf := make([]byte, 16)
+		for {
+			n, err := in.Read(buf)
+			for _, b := range buf[:n] {
+				t.keys <- b
+			}
+			if err != nil {
+				close(t.keys)
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (t *TerminalRenderer) Poll(j *Joypad) bool {
+	for b, frames := range t.held {
+		if frames <= 1 {
+			j.Release(b)
+			delete(t.held, b)
+		} else {
+			t.held[b] = frames - 1
+		}
+	}
+	for more := true; more; {
+		select {
+		case b, ok := <-t.keys:
+			if !ok {
+				return false
+			}
+			t.pending = append(t.pending, b)
+		default:
+			more = false
+		}
+	}
+	for len(t.pending) > 0 {
+		key := t.pending[:1]
+		if t.pending[0] == 0x1b && len(t.pending) >= 3 && t.pending[1] == '[' {
+			key = t.pending[:3]
+		}
+		t.pending = t.pending[len(key):]
+		switch string(key) {
+		case "\x03", "q":
+			return false
+		}
+		if b, ok := terminalKeys[string(key)]; ok {
+			j.Press(b)
+			t.held[b] = terminalHoldFrames
+		}
+	}
+	return true
+}
+
+func (t *TerminalRenderer) color(c color.RGBA, layer int) string {
+	if t.trueColor {
+		return fmt.Sprintf("\x1b[%d;2;%d;%d;%dm", layer, c.R, c.G, c.B)
+	}
+	cube := func(v uint8) int { return (int(v)*5 + 127) / 255 }
+	return fmt.Sprintf("\x1b[%d;5;%dm", layer, 16+36*cube(c.R)+6*cube(c.G)+cube(c.B))
+}
+
+func (t *TerminalRenderer) Draw(img *image.RGBA) error {
+	b := img.Bounds()
+	t.fg, t.bg = "", ""
+	fmt.Fprint(t.out, "\x1b[H")
+	for y := b.Min.Y; y < b.Max.Y; y += 2 {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			fg := t.color(img.RGBAAt(x, y), 38)
+			bg := "\x1b[49m"
+			if y+1 < b.Max.Y {
+				bg = t.color(img.RGBAAt(x, y+1), 48)
+			}
+			if fg != t.fg {
+				t.out.WriteString(fg)
+				t.fg = fg
+			}
+			if bg != t.bg {
+				t.out.WriteString(bg)
+				t.bg = bg
+			}
+			t.out.WriteString("▀")
+		}
+		t.out.WriteString("\x1b[0m\r\n")
+		t.fg, t.bg = "", ""
+	}
+	return t.out.Flush()
+}
+
+func (t *TerminalRenderer) Close() error {
+	fmt.Fprint(t.out, "\x1b[0m\x1b[?25h\r\n")
+	err := t.out.Flush()
+	if t.restore != nil {
+		if rerr := t.restore(); err == nil {
+			err = rerr
+		}
+	}
+	return err
+}
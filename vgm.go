@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	vgmHeaderSize = 0x100
+	vgmVersion    = 0x161
+	vgmSampleRate = 44100
+)
+
+type VGMWriter struct {
+	w       io.WriteSeeker
+	file    *os.File
+	buf     *bufio.Writer
+	start   uint64
+	started bool
+	samples uint64
+	size    int
+	err     error
+}
+
+func NewVGMWriter(w io.WriteSeeker) (*VGMWriter, error) {
+	v := &VGMWriter{w: w, size: vgmHeaderSize}
+	if _, err := w.Write(v.header()); err != nil {
+		return nil, err
+	}
+	v.buf = bufio.NewWriter(w)
+	return v, nil
+}
+
+func CreateVGM(path string) (*VGMWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	v, err := NewVGMWriter(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	v.file = f
+	return v, nil
+}
+
+func (v *VGMWriter) header() []byte {
+	h := make([]byte, vgmHeaderSize)
+	copy(h[0x00:], "Vgm ")
+	binary.LittleEndian.PutUint32(h[0x04:], uint32(v.size-4))
+	binary.LittleEndian.PutUint32(h[0x08:], vgmVersion)
+	binary.LittleEndian.PutUint32(h[0x18:], uint32(v.samples))
+	binary.LittleEndian.PutUint32(h[0x34:], vgmHeaderSize-0x34)
+	binary.LittleEndian.PutUint32(h[0x80:], cpuClock)
+	return h
+}
+
+func (v *VGMWriter) emit(b ...byte) {
+	if v.err != nil {
+		return
+	}
+	if _, err := v.buf.Write(b); err != nil {
+		v.err = err
+	}
+	v.size += len(b)
+}
+
+func (v *VGMWriter) waitUntil(cycle uint64) {
+	if !v.started {
+		v.start = cycle
+		v.started = true
+	}
+	target := (cycle - v.start) * vgmSampleRate / cpuClock
+	for v.samples < target {
+		n := target - v.samples
+		switch {
+		case n == 735:
+			v.emit(0x62)
+		case n == 882:
+			v.emit(0x63)
+		case n <= 16:
+			v.emit(0x70 | byte(n-1))
+		default:
+			n = min(n, 0xFFFF)
+			v.emit(0x61, byte(n), byte(n>>8))
+		}
+		v.samples += n
+	}
+}
+
+func (v *VGMWriter) Log(cycle uint64, addr uint16, val uint8) {
+	v.waitUntil(cycle)
+	v.emit(0xB3, byte(addr-0xFF10), val)
+}
+
+func (v *VGMWriter) Close(cycle uint64) error {
+	err := v.finish(cycle)
+	if v.file != nil {
+		if cerr := v.file.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func (v *VGMWriter) finish(cycle uint64) error {
+	v.waitUntil(cycle)
+	v.emit(0x66)
+	if v.err != nil {
+		return v.err
+	}
+	if err := v.buf.Flush(); err != nil {
+		return err
+	}
+	if _, err := v.w.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := v.w.Write(v.header())
+	return err
+}
+
+type VGMWrite struct {
+	Sample uint64
+	Addr   uint16
+	Val    uint8
+}
+
+type VGMFile struct {
+	Version uint32
+	Clock   uint32
+	Samples uint32
+	Writes  []VGMWrite
+}
+
+func ParseVGM(data []byte) (*VGMFile, error) {
+	if len(data) < 0x84 || string(data[:4]) != "Vgm " {
+		return nil, errors.New("vgm: missing Vgm header")
+	}
+	f := &VGMFile{
+		Version: binary.LittleEndian.Uint32(data[0x08:]),
+		Samples: binary.LittleEndian.Uint32(data[0x18:]),
+		Clock:   binary.LittleEndian.Uint32(data[0x80:]),
+	}
+	pos := 0x34 + int(binary.LittleEndian.Uint32(data[0x34:]))
+	var sample uint64
+	for {
+		if pos >= len(data) {
+			return nil, errors.New("vgm: missing end of data command")
+		}
+		cmd := data[pos]
+		need := map[byte]int{0x61: 3, 0xB3: 3}[cmd]
+		if pos+max(need, 1) > len(data) {
+			return nil, fmt.Errorf("vgm: truncated command 0x%02X at 0x%X", cmd, pos)
+		}
+		switch {
+		case cmd == 0x61:
+			sample += uint64(binary.LittleEndian.Uint16(data[pos+1:]))
+		case cmd == 0x62:
+			sample += 735
+		case cmd == 0x63:
+			sample += 882
+		case cmd&0xF0 == 0x70:
+			sample += uint64(cmd&0x0F) + 1
+		case cmd == 0xB3:
+			f.Writes = append(f.Writes, VGMWrite{Sample: sample, Addr: 0xFF10 + uint16(data[pos+1]), Val: data[pos+2]})
+		case cmd == 0x66:
+			return f, nil
+		default:
+			return nil, fmt.Errorf("vgm: unsupported command 0x%02X at 0x%X", cmd, pos)
+		}
+		pos += max(need, 1)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVGMRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.vgm")
+	v, err := CreateVGM(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	apu := NewAPU()
+	apu.LogVGM(v)
+	dumped := 1 + 0x16 - 2 + 0x10
+
+	samples := func(cycles uint64) uint64 { return cycles * vgmSampleRate / cpuClock }
+	const first, second, tail = 41943, cyclesPerFrame, 4194
+
+	apu.Write(0xFF26, 0x80)
+	apu.Tick(first)
+	apu.Write(0xFF12, 0xF0)
+	apu.Write(0xFF15, 0x12)
+	apu.Write(0xFF27, 0x34)
+	apu.Tick(second)
+	apu.Write(0xFF3F, 0xAB)
+	apu.Tick(tail)
+	if err := apu.StopVGM(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := ParseVGM(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Version != vgmVersion || f.Clock != cpuClock {
+		t.Errorf("header version=%X clock=%d", f.Version, f.Clock)
+	}
+	if want := uint32(samples(first + second + tail)); f.Samples != want {
+		t.Errorf("total samples = %d, want %d", f.Samples, want)
+	}
+	if len(f.Writes) != dumped+3 {
+		t.Fatalf("read %d writes, want %d", len(f.Writes), dumped+3)
+	}
+	for _, w := range f.Writes[:dumped] {
+		if w.Sample != 0 || !apuRegisterUsed(w.Addr) {
+			t.Errorf("state dump write %+v", w)
+		}
+	}
+	want := []VGMWrite{
+		{Sample: 0, Addr: 0xFF26, Val: 0x80},
+		{Sample: samples(first), Addr: 0xFF12, Val: 0xF0},
+		{Sample: samples(first + second), Addr: 0xFF3F, Val: 0xAB},
+	}
+	for i, w := range want {
+		if got := f.Writes[dumped+i]; got != w {
+			t.Errorf("write %d = %+v, want %+v", i, got, w)
+		}
+	}
+}
+
+func TestVGMWriterLeavesCallerFileOpen(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "log.vgm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	v, err := NewVGMWriter(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.Log(0, 0xFF26, 0x80)
+	if err := v.Close(cyclesPerFrame); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte{0}); err != nil {
+		t.Errorf("Close closed the caller's file: %v", err)
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	frameRate    = float64(cpuClock) / cyclesPerFrame
+	gifTimebase  = 100
+	gifMinDelay  = 2
+	rgbFrameSize = 3
+)
+
+type VideoRecorder interface {
+	WriteFrame(img *image.RGBA) error
+	Close() error
+}
+
+func CreateVideoRecorder(path string) (VideoRecorder, error) {
+	if path == "-" {
+		return NewY4MRecorder(os.Stdout), nil
+	}
+	var newRecorder func(io.Writer) VideoRecorder
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".gif":
+		newRecorder = func(w io.Writer) VideoRecorder { return NewGIFRecorder(w) }
+	case ".y4m":
+		newRecorder = func(w io.Writer) VideoRecorder { return NewY4MRecorder(w) }
+	case ".rgb", ".raw":
+		newRecorder = func(w io.Writer) VideoRecorder { return NewRGBRecorder(w) }
+	default:
+		return nil, fmt.Errorf("unknown video format %q, want .gif, .y4m or .rgb", path)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &fileRecorder{VideoRecorder: newRecorder(f), file: f}, nil
+}
+
+type fileRecorder struct {
+	VideoRecorder
+	file *os.File
+}
+
+func (r *fileRecorder) Close() error {
+	err := r.VideoRecorder.Close()
+	if cerr := r.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+type GIFRecorder struct {
+	w      io.Writer
+	anim   gif.GIF
+	frames int
+	shown  int
+}
+
+func NewGIFRecorder(w io.Writer) *GIFRecorder {
+	return &GIFRecorder{w: w}
+}
+
+func (g *GIFRecorder) timestamp(frame int) int {
+	return int(math.Floor(float64(frame) * gifTimebase / frameRate))
+}
+
+func (g *GIFRecorder) WriteFrame(img *image.RGBA) error {
+	now := g.timestamp(g.frames)
+	g.frames++
+	if len(g.anim.Image) > 0 && now-g.shown < gifMinDelay {
+		return nil
+	}
+	if n := len(g.anim.Delay); n > 0 {
+		g.anim.Delay[n-1] = now - g.shown
+	}
+	g.anim.Image = append(g.anim.Image, toPaletted(img))
+	g.anim.Delay = append(g.anim.Delay, gifMinDelay)
+	g.shown = now
+	return nil
+}
+
+func (g *GIFRecorder) Close() error {
+	if n := len(g.anim.Delay); n > 0 {
+		g.anim.Delay[n-1] = max(g.timestamp(g.frames)-g.shown, gifMinDelay)
+	}
+	return gif.EncodeAll(g.w, &g.anim)
+}
+
+func toPaletted(img *image.RGBA) *image.Paletted {
+	var pal color.Palette
+	seen := map[color.RGBA]bool{}
+	for i := 0; i < len(img.Pix) && len(pal) <= 256; i += 4 {
+		c := color.RGBA{R: img.Pix[i], G: img.Pix[i+1], B: img.Pix[i+2], A: img.Pix[i+3]}
+		if !seen[c] {
+			seen[c] = true
+			pal = append(pal, c)
+		}
+	}
+	if len(pal) > 256 {
+		pal = palette.Plan9
+	}
+	dst := image.NewPaletted(img.Bounds(), pal)
+	draw.Draw(dst, dst.Rect, img, img.Rect.Min, draw.Src)
+	return dst
+}
+
+type Y4MRecorder struct {
+	buf    *bufio.Writer
+	header bool
+	planes []byte
+}
+
+func NewY4MRecorder(w io.Writer) *Y4MRecorder {
+	return &Y4MRecorder{buf: bufio.NewWriter(w)}
+}
+
+func (y *Y4MRecorder) WriteFrame(img *image.RGBA) error {
+	b := img.Bounds()
+	if !y.header {
+		y.header = true
+		if _, err := fmt.Fprintf(y.buf, "YUV4MPEG2 W%d H%d F%d:%d Ip A1:1 C444\n", b.Dx(), b.Dy(), cpuClock, cyclesPerFrame); err != nil {
+			return err
+		}
+	}
+	n := b.Dx() * b.Dy()
+	y.planes = y.planes[:0]
+	y.planes = append(y.planes, make([]byte, n*3)...)
+	for i := range n {
+		p := img.Pix[i*4:]
+		r, g, bl := float64(p[0]), float64(p[1]), float64(p[2])
+		y.planes[i] = clampByte(16 + 0.257*r + 0.504*g + 0.098*bl)
+		y.planes[n+i] = clampByte(128 - 0.148*r - 0.291*g + 0.439*bl)
+		y.planes[2*n+i] = clampByte(128 + 0.439*r - 0.368*g - 0.071*bl)
+	}
+	if _, err := y.buf.WriteString("FRAME\n"); err != nil {
+		return err
+	}
+	_, err := y.buf.Write(y.planes)
+	return err
+}
+
+func (y *Y4MRecorder) Close() error {
+	return y.buf.Flush()
+}
+
+func clampByte(v float64) uint8 {
+	return uint8(max(0, min(255, math.Round(v))))
+}
+
+type RGBRecorder struct {
+	buf *bufio.Writer
+}
+
+func NewRGBRecorder(w io.Writer) *RGBRecorder {
+	return &RGBRecorder{buf: bufio.NewWriter(w)}
+}
+
+func (r *RGBRecorder) WriteFrame(img *image.RGBA) error {
+	for i := 0; i < len(img.Pix); i += 4 {
+		if _, err := r.buf.Write(img.Pix[i : i+rgbFrameSize]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *RGBRecorder) Close() error {
+	return r.buf.Flush()
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+)
+
+const (
+	tileSheetColumns = 16
+	tileSheetRows    = 24
+	oamEntries       = 40
+	oamViewColumns   = 8
+	oamCellWidth     = 10
+	oamCellHeight    = 18
+)
+
+var viewportColor = color.RGBA{R: 0xFF, A: 0xFF}
+
+type OAMEntry struct {
+	Y, X       uint8
+	Tile       uint8
+	Flags      uint8
+	Priority   bool
+	FlipY      bool
+	FlipX      bool
+	Palette    int
+	Bank       int
+	CGBPalette int
+}
+
+func (m *MMU) tilePixel(bank, addr, x, y int) uint8 {
+	lo := m.vram[bank][addr+y*2]
+	hi := m.vram[bank][addr+y*2+1]
+	bit := 7 - x
+	return lo>>bit&1 | hi>>bit&1<<1
+}
+
+func dmgShade(reg, index uint8) uint8 {
+	return reg >> (index * 2) & 0x03
+}
+
+func (m *MMU) bgPixelColor(attr, index uint8, p DMGPalette) color.RGBA {
+	if m.cgb {
+		return RGB555ToRGBA(m.BGColor(int(attr&0x07), int(index)))
+	}
+	return p[dmgShade(m.io[0x47], index)]
+}
+
+func (m *MMU) objPixelColor(e OAMEntry, index uint8, p DMGPalette) color.RGBA {
+	if m.cgb {
+		return RGB555ToRGBA(m.OBJColor(e.CGBPalette, int(index)))
+	}
+	return p[dmgShade(m.io[0x48+e.Palette], index)]
+}
+
+func (m *MMU) TileSheet(bank int, p DMGPalette) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, tileSheetColumns*8, tileSheetRows*8))
+	for tile := range tileSheetColumns * tileSheetRows {
+		tx, ty := tile%tileSheetColumns*8, tile/tileSheetColumns*8
+		for y := range 8 {
+			for x := range 8 {
+				img.SetRGBA(tx+x, ty+y, p[m.tilePixel(bank, tile*16, x, y)])
+			}
+		}
+	}
+	return img
+}
+
+func (m *MMU) bgTileAddr(tile uint8) int {
+	if m.io[0x40]&0x10 != 0 {
+		return int(tile) * 16
+	}
+	return 0x1000 + int(int8(tile))*16
+}
+
+func (m *MMU) BGMap(index int, p DMGPalette) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 256, 256))
+	base := 0x1800 + index*0x400
+	for ty := range 32 {
+		for tx := range 32 {
+			tile := m.vram[0][base+ty*32+tx]
+			attr := m.vram[1][base+ty*32+tx]
+			bank := 0
+			if m.cgb && attr&0x08 != 0 {
+				bank = 1
+			}
+			for y := range 8 {
+				for x := range 8 {
+					px, py := x, y
+					if m.cgb && attr&0x20 != 0 {
+						px = 7 - x
+					}
+					if m.cgb && attr&0x40 != 0 {
+						py = 7 - y
+					}
+					index := m.tilePixel(bank, m.bgTileAddr(tile), px, py)
+					img.SetRGBA(tx*8+x, ty*8+y, m.bgPixelColor(attr, index, p))
+				}
+			}
+		}
+	}
+	m.outlineViewport(img)
+	return img
+}
+
+func (m *MMU) outlineViewport(img *image.RGBA) {
+	scx, scy := int(m.io[0x43]), int(m.io[0x42])
+	for i := range ScreenWidth {
+		img.SetRGBA((scx+i)%256, scy, viewportColor)
+		img.SetRGBA((scx+i)%256, (scy+ScreenHeight-1)%256, viewportColor)
+	}
+	for i := range ScreenHeight {
+		img.SetRGBA(scx, (scy+i)%256, viewportColor)
+		img.SetRGBA((scx+ScreenWidth-1)%256, (scy+i)%256, viewportColor)
+	}
+}
+
+func (m *MMU) OAMEntries() []OAMEntry {
+	entries := make([]OAMEntry, oamEntries)
+	for i := range entries {
+		o := m.oam[i*4:]
+		entries[i] = OAMEntry{
+			Y:          o[0],
+			X:          o[1],
+			Tile:       o[2],
+			Flags:      o[3],
+			Priority:   o[3]&0x80 != 0,
+			FlipY:      o[3]&0x40 != 0,
+			FlipX:      o[3]&0x20 != 0,
+			Palette:    int(o[3] >> 4 & 0x01),
+			Bank:       int(o[3] >> 3 & 0x01),
+			CGBPalette: int(o[3] & 0x07),
+		}
+	}
+	return entries
+}
+
+func (e OAMEntry) String() string {
+	return fmt.Sprintf("x=%3d y=%3d tile=%02X flags=%02X", int(e.X)-8, int(e.Y)-16, e.Tile, e.Flags)
+}
+
+func (m *MMU) OAMImage(p DMGPalette) *image.RGBA {
+	rows := oamEntries / oamViewColumns
+	img := image.NewRGBA(image.Rect(0, 0, oamViewColumns*oamCellWidth, rows*oamCellHeight))
+	height := 8
+	if m.io[0x40]&0x04 != 0 {
+		height = 16
+	}
+	for i, e := range m.OAMEntries() {
+		cx, cy := i%oamViewColumns*oamCellWidth+1, i/oamViewColumns*oamCellHeight+1
+		bank := 0
+		if m.cgb {
+			bank = e.Bank
+		}
+		tile := int(e.Tile)
+		if height == 16 {
+			tile &^= 1
+		}
+		for y := range height {
+			for x := range 8 {
+				px, py := x, y
+				if e.FlipX {
+					px = 7 - x
+				}
+				if e.FlipY {
+					py = height - 1 - y
+				}
+				index := m.tilePixel(bank, tile*16+py/8*16, px, py%8)
+				if index == 0 {
+					continue
+				}
+				img.SetRGBA(cx+x, cy+y, m.objPixelColor(e, index, p))
+			}
+		}
+	}
+	return img
+}
+
+func (m *MMU) DumpVRAM(prefix string, p DMGPalette) error {
+	images := map[string]image.Image{
+		"tiles": m.TileSheet(0, p),
+		"map0":  m.BGMap(0, p),
+		"map1":  m.BGMap(1, p),
+		"oam":   m.OAMImage(p),
+	}
+	if m.cgb {
+		images["tiles1"] = m.TileSheet(1, p)
+	}
+	for name, img := range images {
+		if err := SavePNG(fmt.Sprintf("%s-%s.png", prefix, name), img); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+)
+
+const wavHeaderSize = 44
+
+type WAVWriter struct {
+	w          io.WriteSeeker
+	file       *os.File
+	channels   int
+	sampleRate int
+	dataSize   uint32
+	buf        []byte
+}
+
+func NewWAVWriter(w io.WriteSeeker, sampleRate, channels int) (*WAVWriter, error) {
+	wav := &WAVWriter{w: w, channels: channels, sampleRate: sampleRate}
+	if _, err := w.Write(wav.header()); err != nil {
+		return nil, err
+	}
+	return wav, nil
+}
+
+func CreateWAV(path string, sampleRate, channels int) (*WAVWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	wav, err := NewWAVWriter(f, sampleRate, channels)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	wav.file = f
+	return wav, nil
+}
+
+func (w *WAVWriter) header() []byte {
+	h := make([]byte, wavHeaderSize)
+	blockAlign := w.channels * 2
+	copy(h[0:], "RIFF")
+	binary.LittleEndian.PutUint32(h[4:], 36+w.dataSize)
+	copy(h[8:], "WAVE")
+	copy(h[12:], "fmt ")
+	binary.LittleEndian.PutUint32(h[16:], 16)
+	binary.LittleEndian.PutUint16(h[20:], 1)
+	binary.LittleEndian.PutUint16(h[22:], uint16(w.channels))
+	binary.LittleEndian.PutUint32(h[24:], uint32(w.sampleRate))
+	binary.LittleEndian.PutUint32(h[28:], uint32(w.sampleRate*blockAlign))
+	binary.LittleEndian.PutUint16(h[32:], uint16(blockAlign))
+	binary.LittleEndian.PutUint16(h[34:], 16)
+	copy(h[36:], "data")
+	binary.LittleEndian.PutUint32(h[40:], w.dataSize)
+	return h
+}
+
+func (w *WAVWriter) Write(samples []int16) error {
+	if len(samples) == 0 {
+		return nil
+	}
+	w.buf = w.buf[:0]
+	for _, s := range samples {
+		w.buf = binary.LittleEndian.AppendUint16(w.buf, uint16(s))
+	}
+	if _, err := w.w.Write(w.buf); err != nil {
+		return err
+	}
+	w.dataSize += uint32(len(w.buf))
+	return w.updateHeader()
+}
+
+func (w *WAVWriter) updateHeader() error {
+	if _, err := w.w.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := w.w.Write(w.header()); err != nil {
+		return err
+	}
+	_, err := w.w.Seek(0, io.SeekEnd)
+	return err
+}
+
+func (w *WAVWriter) Close() error {
+	err := w.updateHeader()
+	if w.file != nil {
+		if cerr := w.file.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func (g *GameBoy) RecordWAV(w io.WriteSeeker, sampleRate, frames int) (err error) {
+	apu := g.MMU.APU()
+	apu.SetSampleRate(sampleRate)
+	wav, err := NewWAVWriter(w, sampleRate, 2)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := wav.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	for range frames {
+		g.RunFrame()
+		if err := wav.Write(apu.Samples()); err != nil {
+			return err
+		}
+	}
+	return nil
+}